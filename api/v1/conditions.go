@@ -0,0 +1,17 @@
+package v1
+
+// Condition types reported in the status of Emails and EmailSenderConfigs.
+const (
+	// ConditionReady is True once an Email has been sent, or rendered in a
+	// dry run, and while an EmailSenderConfig can be used to send.
+	ConditionReady = "Ready"
+	// ConditionSent is True once a provider accepted an Email.
+	ConditionSent = "Sent"
+	// ConditionRetrying is True while an Email waits to be retried after a
+	// retryable error.
+	ConditionRetrying = "Retrying"
+	// ConditionDegraded is True when an Email failed, expired or had
+	// recipients rejected, and while a backend of an EmailSenderConfig is
+	// failing.
+	ConditionDegraded = "Degraded"
+)
@@ -1,27 +1,295 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// EmailAddress is a mailbox with an optional display name.
+type EmailAddress struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// BodyFormat is the format of an Email's body.
+// +kubebuilder:validation:Enum=markdown;html;text
+type BodyFormat string
+
+const (
+	BodyFormatMarkdown BodyFormat = "markdown"
+	BodyFormatHTML     BodyFormat = "html"
+	BodyFormatText     BodyFormat = "text"
+)
+
+// AttachmentDisposition says how a mail client presents an attachment.
+// +kubebuilder:validation:Enum=attachment;inline
+type AttachmentDisposition string
+
+const (
+	// AttachmentDispositionAttachment offers the file for download.
+	AttachmentDispositionAttachment AttachmentDisposition = "attachment"
+	// AttachmentDispositionInline embeds the file in the HTML body, which
+	// references it as cid:<contentID>.
+	AttachmentDispositionInline AttachmentDisposition = "inline"
+)
+
+// Attachment is a file attached to an Email. Exactly one of ConfigMapKeyRef,
+// SecretKeyRef and FilePath must be set.
+type Attachment struct {
+	// Filename is the name the recipient sees.
+	Filename string `json:"filename"`
+	// ContentType is the MIME type of the file. Defaults from the filename
+	// extension, or application/octet-stream.
+	ContentType string `json:"contentType,omitempty"`
+	// Disposition defaults to attachment.
+	Disposition AttachmentDisposition `json:"disposition,omitempty"`
+	// ContentID identifies an inline attachment in the HTML body.
+	// Defaults to the filename.
+	ContentID string `json:"contentID,omitempty"`
+
+	// ConfigMapKeyRef selects a key of a ConfigMap in the Email's namespace.
+	// Both data and binaryData keys are supported.
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef selects a key of a Secret in the Email's namespace.
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// FilePath is the path of a file under the operator's attachment
+	// directory, usually a mounted volume.
+	FilePath string `json:"filePath,omitempty"`
+}
+
+// TemplateDataSource is a source of template values. Exactly one of
+// ConfigMapRef, SecretRef and ObjectRef must be set.
+type TemplateDataSource struct {
+	// ConfigMapRef adds every key of a ConfigMap as a string value.
+	ConfigMapRef *corev1.LocalObjectReference `json:"configMapRef,omitempty"`
+	// SecretRef adds every key of a Secret as a string value.
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// ObjectRef adds a field of any object in the Email's namespace.
+	ObjectRef *TemplateObjectReference `json:"objectRef,omitempty"`
+}
+
+// TemplateObjectReference selects a field of a Kubernetes object in the
+// Email's namespace. The operator needs RBAC to get the object's kind.
+type TemplateObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	// JSONPath selects the field, as a kubectl style template such as
+	// {.spec.template.spec.containers[0].image}, a $-rooted path or a
+	// dotted path. Paths matching several fields give a list.
+	JSONPath string `json:"jsonPath"`
+	// Key is the template value the field is stored under.
+	Key string `json:"key"`
+}
+
+// ProviderTemplate selects a template hosted by the email provider, so it
+// can be edited in the provider's UI. MailerSend, Mailgun, SendGrid and
+// Postmark support provider templates.
+type ProviderTemplate struct {
+	// ID identifies the template: a MailerSend template id, a Mailgun
+	// template name, a SendGrid dynamic template id, or a Postmark template
+	// id or alias.
+	ID string `json:"id"`
+	// Variables are the values every recipient's copy is rendered with.
+	Variables map[string]apiextensionsv1.JSON `json:"variables,omitempty"`
+	// Personalization overrides Variables for individual recipients.
+	Personalization []TemplatePersonalization `json:"personalization,omitempty"`
+}
+
+// TemplatePersonalization holds the template variables of one recipient.
+type TemplatePersonalization struct {
+	Email     string                          `json:"email"`
+	Variables map[string]apiextensionsv1.JSON `json:"variables"`
+}
+
 // EmailSpec defines the desired state of Email
 type EmailSpec struct {
-	RecipientEmail  string `json:"recipientEmail"`
+	// RecipientEmail is a single To recipient. Prefer To for new Emails.
+	RecipientEmail  string `json:"recipientEmail,omitempty"`
 	SenderConfigRef string `json:"senderConfigRef"`
-	Subject         string `json:"subject"`
-	Body            string `json:"body"`
+	Subject         string `json:"subject,omitempty"`
 	Provider        string `json:"provider"`
+
+	// SenderEmail is the address to send from. It must be the sender
+	// config's senderEmail or match one of its allowedSenders. Defaults to
+	// the sender config's senderEmail.
+	SenderEmail string `json:"senderEmail,omitempty"`
+	// FromName is the sender's display name, overriding the sender config's.
+	FromName string `json:"fromName,omitempty"`
+	// ReplyTo is where replies go, overriding the sender config's.
+	ReplyTo *EmailAddress `json:"replyTo,omitempty"`
+	// Headers are extra message headers. Headers the operator or provider
+	// sets, such as From, To, Subject, Reply-To, Message-ID and Content-*,
+	// cannot be set here.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// HTMLBody is the HTML body of the email. When TextBody is empty a
+	// plain-text alternative is generated from it.
+	HTMLBody string `json:"htmlBody,omitempty"`
+	// TextBody is the plain-text body of the email.
+	TextBody string `json:"textBody,omitempty"`
+	// Body is a body in BodyFormat, used when neither HTMLBody nor TextBody
+	// is set.
+	Body string `json:"body,omitempty"`
+	// BodyFormat is the format of Body. Markdown is rendered to HTML,
+	// wrapped in the layout, with a plain-text alternative. Defaults to text.
+	BodyFormat BodyFormat `json:"bodyFormat,omitempty"`
+	// LayoutRef names an EmailTemplate whose htmlBody wraps Markdown bodies,
+	// overriding the sender config's layout.
+	LayoutRef string `json:"layoutRef,omitempty"`
+
+	// Attachments are files sent with the email.
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// TemplateRef names an EmailTemplate in the Email's namespace. When set,
+	// the template's rendered subject and bodies replace the Email's own.
+	// Otherwise, when TemplateData or TemplateDataFrom is set, the Email's
+	// own subject and bodies are rendered as Go templates.
+	TemplateRef string `json:"templateRef,omitempty"`
+	// TemplateData holds the values the template is rendered with. Values
+	// may be any JSON: strings, numbers, lists or objects. They override
+	// values from TemplateDataFrom.
+	TemplateData map[string]apiextensionsv1.JSON `json:"templateData,omitempty"`
+	// TemplateDataFrom lists sources of template values. Later sources
+	// override earlier ones.
+	TemplateDataFrom []TemplateDataSource `json:"templateDataFrom,omitempty"`
+
+	// ProviderTemplate sends a template hosted by the provider instead of
+	// the Email's own bodies. It cannot be combined with htmlBody, textBody,
+	// body or templateRef.
+	ProviderTemplate *ProviderTemplate `json:"providerTemplate,omitempty"`
+
+	// To, Cc and Bcc list the recipients. At least one recipient is
+	// required across these and RecipientEmail.
+	To  []EmailAddress `json:"to,omitempty"`
+	Cc  []EmailAddress `json:"cc,omitempty"`
+	Bcc []EmailAddress `json:"bcc,omitempty"`
+
+	// DryRun renders and validates the email against its sender config
+	// without sending it.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// SendAt holds the email back until this time: either an RFC 3339 time
+	// such as 2024-05-01T08:00:00+02:00, or a local time such as
+	// 2024-05-01T08:00:00 in TimeZone.
+	SendAt string `json:"sendAt,omitempty"`
+	// TimeZone is the IANA time zone, such as Europe/Berlin, a local SendAt
+	// is in. Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// ExpireAt is when an unsent email is given up on. It is marked Expired
+	// instead of being sent late.
+	ExpireAt *metav1.Time `json:"expireAt,omitempty"`
+
+	// RetryPolicy overrides fields of the sender config's retry policy.
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
 }
 
+// EmailPhase is where an Email is in its delivery.
+// +kubebuilder:validation:Enum=Pending;Scheduled;Sending;Retrying;Sent;Failed;Expired;DryRun
+type EmailPhase string
+
+const (
+	// EmailPhasePending is an Email waiting for its sender config or
+	// credentials before its first attempt.
+	EmailPhasePending EmailPhase = "Pending"
+	// EmailPhaseScheduled is an Email held back until its sendAt.
+	EmailPhaseScheduled EmailPhase = "Scheduled"
+	// EmailPhaseSending is an Email being handed to a provider.
+	EmailPhaseSending EmailPhase = "Sending"
+	// EmailPhaseRetrying is an Email that failed with a retryable error and
+	// is tried again at status.nextRetryTime.
+	EmailPhaseRetrying EmailPhase = "Retrying"
+	// EmailPhaseSent is an Email a provider accepted.
+	EmailPhaseSent EmailPhase = "Sent"
+	// EmailPhaseFailed is an Email that failed permanently or ran out of
+	// attempts.
+	EmailPhaseFailed EmailPhase = "Failed"
+	// EmailPhaseExpired is an Email that was not sent before its expireAt.
+	EmailPhaseExpired EmailPhase = "Expired"
+	// EmailPhaseDryRun is an Email rendered without being sent.
+	EmailPhaseDryRun EmailPhase = "DryRun"
+)
+
 // EmailStatus defines the observed state of Email
 type EmailStatus struct {
-	DeliveryStatus string `json:"deliveryStatus"`
-	MessageID      string `json:"messageID"`
-	Error          string `json:"error,omitempty"`
+	// ObservedGeneration is the generation of the spec the status was
+	// last written for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are the Ready, Sent, Retrying and Degraded conditions of
+	// the Email.
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// DeliveryStatus is the phase the Email is in.
+	DeliveryStatus EmailPhase `json:"deliveryStatus"`
+	MessageID      string     `json:"messageID"`
+	Error          string     `json:"error,omitempty"`
+	// Attempts counts the times sending was tried, each try going through
+	// the sender config's backends once. Only tries that reach a provider
+	// count, so an Email that fails before one, say on a template error,
+	// has none.
+	Attempts int32 `json:"attempts,omitempty"`
+	// FirstAttemptTime is when sending was first tried. A retry policy's
+	// deadline counts from it.
+	FirstAttemptTime *metav1.Time `json:"firstAttemptTime,omitempty"`
+	// LastAttemptTime is when sending was last tried.
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+	// NextRetryTime is when a Retrying email is tried again.
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+	// RenderedMessage is the MIME message produced by a dry run.
+	RenderedMessage string `json:"renderedMessage,omitempty"`
+	// Backend is the sender config backend the email was last handed to,
+	// which delivered it once it is Sent.
+	Backend string `json:"backend,omitempty"`
+	// Provider is the provider Backend uses.
+	Provider string `json:"provider,omitempty"`
+	// AttemptID identifies the attempt being handed to Backend. It is
+	// recorded before the provider is called and cleared once the outcome
+	// is, so an Email still carrying one may have been sent without its
+	// status saying so. It is checked with MailerSend, Mailgun, Postmark
+	// and SendGrid before resending. SMTP, SES, Webhook and Capture
+	// backends cannot be asked, so such an attempt is sent again under the
+	// same key, and only a receiver that deduplicates on the Message-ID or
+	// Idempotency-Key header avoids a duplicate.
+	AttemptID string `json:"attemptID,omitempty"`
+	// DeliveryAttempts records every send attempt, oldest first.
+	DeliveryAttempts []DeliveryAttempt `json:"deliveryAttempts,omitempty"`
+	// Recipients reports whether each recipient was accepted, for providers
+	// that say so.
+	Recipients []RecipientStatus `json:"recipients,omitempty"`
+	// ScheduledFor is when a scheduled email goes out.
+	ScheduledFor *metav1.Time `json:"scheduledFor,omitempty"`
+}
+
+// RecipientStatus is a provider's verdict on a single recipient.
+type RecipientStatus struct {
+	Email    string `json:"email"`
+	Accepted bool   `json:"accepted"`
+	// Error is why the recipient was rejected.
+	Error string `json:"error,omitempty"`
+}
+
+// DeliveryAttempt is one attempt to send an Email through a backend.
+type DeliveryAttempt struct {
+	// Backend is the name of the backend that was tried.
+	Backend string `json:"backend"`
+	// Provider is the provider the backend uses.
+	Provider string `json:"provider"`
+	// Time is when the attempt was made.
+	Time metav1.Time `json:"time"`
+	// Error is why the attempt failed. Empty when it succeeded.
+	Error string `json:"error,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.deliveryStatus`
+//+kubebuilder:printcolumn:name="Provider",type=string,JSONPath=`.status.provider`
+//+kubebuilder:printcolumn:name="Recipient",type=string,JSONPath=`.spec.recipientEmail`
+//+kubebuilder:printcolumn:name="To",type=string,JSONPath=`.spec.to[0].email`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Email is the Schema for the emails API
 type Email struct {
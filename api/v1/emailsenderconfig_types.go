@@ -4,19 +4,259 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// ProviderType names an email provider implementation.
+// +kubebuilder:validation:Enum=MailerSend;Mailgun;SMTP;SendGrid;Postmark;SES;Webhook;Log;Capture
+type ProviderType string
+
+const (
+	ProviderMailerSend ProviderType = "MailerSend"
+	ProviderMailgun    ProviderType = "Mailgun"
+	ProviderSMTP       ProviderType = "SMTP"
+	ProviderSendGrid   ProviderType = "SendGrid"
+	ProviderPostmark   ProviderType = "Postmark"
+	ProviderSES        ProviderType = "SES"
+	ProviderWebhook    ProviderType = "Webhook"
+	// ProviderLog renders messages into status, an Event and the operator
+	// log without sending them.
+	ProviderLog ProviderType = "Log"
+	// ProviderCapture keeps messages in the manager's captured email inbox.
+	// It is only available when the manager runs with --capture-bind-address.
+	ProviderCapture ProviderType = "Capture"
+)
+
+// MailgunRegion selects the Mailgun API region.
+// +kubebuilder:validation:Enum=US;EU
+type MailgunRegion string
+
+const (
+	MailgunRegionUS MailgunRegion = "US"
+	MailgunRegionEU MailgunRegion = "EU"
+)
+
+// MailgunSpec configures the Mailgun provider.
+type MailgunSpec struct {
+	// Domain is the Mailgun sending domain.
+	Domain string `json:"domain"`
+	// Region is the Mailgun region the domain lives in. Defaults to US.
+	Region MailgunRegion `json:"region,omitempty"`
+}
+
+// SMTPTLSMode selects how an SMTP connection is secured.
+// +kubebuilder:validation:Enum=None;STARTTLS;Implicit
+type SMTPTLSMode string
+
+const (
+	SMTPTLSNone     SMTPTLSMode = "None"
+	SMTPTLSStartTLS SMTPTLSMode = "STARTTLS"
+	SMTPTLSImplicit SMTPTLSMode = "Implicit"
+)
+
+// SMTPAuthMechanism selects the SMTP AUTH mechanism.
+// +kubebuilder:validation:Enum=None;PLAIN;LOGIN;CRAM-MD5
+type SMTPAuthMechanism string
+
+const (
+	SMTPAuthNone    SMTPAuthMechanism = "None"
+	SMTPAuthPlain   SMTPAuthMechanism = "PLAIN"
+	SMTPAuthLogin   SMTPAuthMechanism = "LOGIN"
+	SMTPAuthCRAMMD5 SMTPAuthMechanism = "CRAM-MD5"
+)
+
+// SMTPSpec configures the SMTP provider. Credentials are read from the
+// username and password keys of the referenced Secret.
+type SMTPSpec struct {
+	// Host is the SMTP server host name.
+	Host string `json:"host"`
+	// Port is the SMTP server port. Defaults to 465 for Implicit TLS and 587 otherwise.
+	Port int32 `json:"port,omitempty"`
+	// TLSMode secures the connection. Defaults to STARTTLS.
+	TLSMode SMTPTLSMode `json:"tlsMode,omitempty"`
+	// Auth is the AUTH mechanism. Defaults to PLAIN when a username is set, None otherwise.
+	Auth SMTPAuthMechanism `json:"auth,omitempty"`
+	// InsecureSkipVerify disables verification of the server certificate.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// ConnectTimeout bounds establishing the connection. Defaults to 10s.
+	ConnectTimeout *metav1.Duration `json:"connectTimeout,omitempty"`
+	// Timeout bounds the whole SMTP conversation. Defaults to 30s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// PostmarkSpec configures the Postmark provider.
+type PostmarkSpec struct {
+	// MessageStream is the Postmark message stream to send through. Defaults
+	// to the server's default transactional stream.
+	MessageStream string `json:"messageStream,omitempty"`
+}
+
+// SESSpec configures the Amazon SES v2 provider. Credentials are read from
+// the access-key-id, secret-access-key and optional session-token keys of the
+// referenced Secret.
+type SESSpec struct {
+	// Region is the AWS region, e.g. eu-west-1.
+	Region string `json:"region"`
+	// Endpoint overrides the SES endpoint, e.g. for LocalStack.
+	Endpoint string `json:"endpoint,omitempty"`
+	// ConfigurationSetName is the SES configuration set to send with.
+	ConfigurationSetName string `json:"configurationSetName,omitempty"`
+}
+
+// WebhookHeader is an HTTP header sent by the Webhook provider.
+type WebhookHeader struct {
+	// Name is the header name.
+	Name string `json:"name"`
+	// Value is a literal header value.
+	Value string `json:"value,omitempty"`
+	// SecretKey reads the value from this key of the referenced Secret instead.
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// WebhookSpec configures the Webhook provider, which calls an arbitrary HTTP
+// mail gateway.
+type WebhookSpec struct {
+	// URL is the endpoint to call.
+	URL string `json:"url"`
+	// Method is the HTTP method. Defaults to POST.
+	Method string `json:"method,omitempty"`
+	// ContentType of the request body. Defaults to application/json.
+	ContentType string `json:"contentType,omitempty"`
+	// Headers are added to every request.
+	Headers []WebhookHeader `json:"headers,omitempty"`
+	// BodyTemplate is a Go text/template rendered with the outgoing message
+	// (.From, .ReplyTo, .To, .Subject, .HTML, .Text, .Headers,
+	// .IdempotencyKey). The json function quotes values. Requests also carry
+	// the idempotency key in an Idempotency-Key header.
+	BodyTemplate string `json:"bodyTemplate"`
+	// MessageIDPath extracts the message id from a JSON response, either as
+	// a JSONPath ({.data.id} or $.data.id) or a dotted path (data.id). A
+	// successful response it finds nothing in still counts as sent, with an
+	// empty message id.
+	MessageIDPath string `json:"messageIDPath,omitempty"`
+}
+
+// ProviderSettings selects and configures an email provider.
+type ProviderSettings struct {
+	// Provider names the email provider used to send mail. Defaults to MailerSend.
+	Provider ProviderType `json:"provider,omitempty"`
+	// Mailgun configures the Mailgun provider.
+	Mailgun *MailgunSpec `json:"mailgun,omitempty"`
+	// SMTP configures the SMTP provider.
+	SMTP *SMTPSpec `json:"smtp,omitempty"`
+	// Postmark configures the Postmark provider.
+	Postmark *PostmarkSpec `json:"postmark,omitempty"`
+	// SES configures the Amazon SES provider.
+	SES *SESSpec `json:"ses,omitempty"`
+	// Webhook configures the Webhook provider.
+	Webhook *WebhookSpec `json:"webhook,omitempty"`
+}
+
+// RetryPolicy controls how Emails are retried after retryable errors.
+// Unset fields keep their defaults.
+type RetryPolicy struct {
+	// MaxAttempts is how many times an Email is tried before it fails.
+	// Defaults to 10.
+	//+kubebuilder:validation:Minimum=1
+	MaxAttempts *int32 `json:"maxAttempts,omitempty"`
+	// InitialBackoff is the wait before the first retry. Defaults to 10s.
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+	// MaxBackoff caps the wait between retries. Defaults to 10m.
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+	// Multiplier is what the wait grows by after every retry, a decimal
+	// such as 1.5 that is at least 1. Defaults to 2.
+	//+kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	Multiplier string `json:"multiplier,omitempty"`
+	// Deadline is how long after its first attempt an Email may still be
+	// retried. There is no deadline by default.
+	Deadline *metav1.Duration `json:"deadline,omitempty"`
+	// RetryableStatusCodes are the HTTP status codes from a provider API
+	// that are retried. Defaults to 429 and every 5xx code. Timeouts,
+	// connection failures and SMTP 4xx replies are always retried.
+	RetryableStatusCodes []int32 `json:"retryableStatusCodes,omitempty"`
+}
+
+// ProviderBackend is one entry in an EmailSenderConfig's failover chain.
+type ProviderBackend struct {
+	// Name identifies the backend in Email status.
+	Name string `json:"name"`
+	// SecretRef names the Secret holding this backend's credentials.
+	// Defaults to the config's apiTokenSecretRef.
+	SecretRef string `json:"secretRef,omitempty"`
+	// Weight is this backend's relative share of emails. Each Email starts
+	// at a backend picked by hashing its UID, so retries stick to the same
+	// backend. A backend with weight 0 only receives failover traffic. When
+	// no backend has a weight, emails start at the first backend.
+	//+kubebuilder:validation:Minimum=0
+	Weight *int32 `json:"weight,omitempty"`
+
+	ProviderSettings `json:",inline"`
+}
+
 // EmailSenderConfigSpec defines the desired state of EmailSenderConfig
 type EmailSenderConfigSpec struct {
+	// ApiTokenSecretRef names the Secret holding the provider credentials.
 	ApiTokenSecretRef string `json:"apiTokenSecretRef,omitempty"`
-	SenderEmail       string `json:"senderEmail,omitempty"`
+	// SenderEmail is the address emails are sent from unless an Email picks
+	// one of AllowedSenders. The from-email key of the Secret is only read
+	// when this is empty, for configs created before it was honoured.
+	SenderEmail string `json:"senderEmail,omitempty"`
+	// AllowedSenders are further addresses Emails may send from with
+	// spec.senderEmail. An entry of the form @example.com allows any address
+	// at that domain.
+	AllowedSenders []string `json:"allowedSenders,omitempty"`
+	// FromName is the display name emails are sent with.
+	FromName string `json:"fromName,omitempty"`
+	// ReplyTo is where replies to emails go.
+	ReplyTo *EmailAddress `json:"replyTo,omitempty"`
+
+	ProviderSettings `json:",inline"`
+
+	// Backends is an ordered failover chain. When set, the provider fields
+	// above are ignored and each backend is tried in turn until one accepts
+	// the email or fails with a permanent error. Weighted backends split
+	// traffic between them; see ProviderBackend.Weight.
+	Backends []ProviderBackend `json:"backends,omitempty"`
+
+	// RetryPolicy controls how Emails sent with this config are retried.
+	// Emails may override it field by field.
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// Layout is an html/template that wraps the HTML rendered from Markdown
+	// bodies. It is given .Subject and .Content, the rendered body.
+	Layout string `json:"layout,omitempty"`
 }
 
 // EmailSenderConfigStatus defines the observed state of EmailSenderConfig
 type EmailSenderConfigStatus struct {
 	Error string `json:"error,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status was
+	// last written for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are the Ready and Degraded conditions of the config.
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Backends counts the send attempts made through each backend.
+	Backends []BackendStatus `json:"backends,omitempty"`
+}
+
+// BackendStatus reports how a backend of an EmailSenderConfig has been used.
+type BackendStatus struct {
+	Name string `json:"name"`
+	// Sent counts the emails the backend accepted.
+	Sent int64 `json:"sent"`
+	// Failed counts the send attempts the backend rejected.
+	Failed int64 `json:"failed"`
+	// LastError is why the backend's last send attempt failed. It is
+	// cleared when the backend next accepts an email.
+	LastError string `json:"lastError,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Provider",type=string,JSONPath=`.spec.provider`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // EmailSenderConfig is the Schema for the emailsenderconfigs API
 type EmailSenderConfig struct {
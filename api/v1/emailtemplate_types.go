@@ -0,0 +1,47 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EmailTemplateSpec defines the desired state of EmailTemplate
+type EmailTemplateSpec struct {
+	// Subject is a text/template for the subject line.
+	Subject string `json:"subject"`
+	// HTMLBody is an html/template for the HTML body, so data is escaped
+	// for the context it appears in.
+	HTMLBody string `json:"htmlBody,omitempty"`
+	// TextBody is a text/template for the plain-text body. When empty, a
+	// plain-text alternative is generated from the rendered HTMLBody.
+	TextBody string `json:"textBody,omitempty"`
+}
+
+// EmailTemplateStatus defines the observed state of EmailTemplate
+type EmailTemplateStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=etpl
+
+// EmailTemplate is the Schema for the emailtemplates API
+type EmailTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EmailTemplateSpec   `json:"spec,omitempty"`
+	Status EmailTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// EmailTemplateList contains a list of EmailTemplate
+type EmailTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EmailTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EmailTemplate{}, &EmailTemplateList{})
+}
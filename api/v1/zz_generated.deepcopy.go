@@ -21,16 +21,75 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Attachment) DeepCopyInto(out *Attachment) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Attachment.
+func (in *Attachment) DeepCopy() *Attachment {
+	if in == nil {
+		return nil
+	}
+	out := new(Attachment)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendStatus) DeepCopyInto(out *BackendStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendStatus.
+func (in *BackendStatus) DeepCopy() *BackendStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeliveryAttempt) DeepCopyInto(out *DeliveryAttempt) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeliveryAttempt.
+func (in *DeliveryAttempt) DeepCopy() *DeliveryAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(DeliveryAttempt)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Email) DeepCopyInto(out *Email) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Email.
@@ -51,6 +110,21 @@ func (in *Email) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailAddress) DeepCopyInto(out *EmailAddress) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailAddress.
+func (in *EmailAddress) DeepCopy() *EmailAddress {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailAddress)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EmailList) DeepCopyInto(out *EmailList) {
 	*out = *in
@@ -88,8 +162,8 @@ func (in *EmailSenderConfig) DeepCopyInto(out *EmailSenderConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailSenderConfig.
@@ -141,3 +215,601 @@ func (in *EmailSenderConfigList) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailSenderConfigSpec) DeepCopyInto(out *EmailSenderConfigSpec) {
+	*out = *in
+	if in.AllowedSenders != nil {
+		in, out := &in.AllowedSenders, &out.AllowedSenders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReplyTo != nil {
+		in, out := &in.ReplyTo, &out.ReplyTo
+		*out = new(EmailAddress)
+		**out = **in
+	}
+	in.ProviderSettings.DeepCopyInto(&out.ProviderSettings)
+	if in.Backends != nil {
+		in, out := &in.Backends, &out.Backends
+		*out = make([]ProviderBackend, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailSenderConfigSpec.
+func (in *EmailSenderConfigSpec) DeepCopy() *EmailSenderConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailSenderConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailSenderConfigStatus) DeepCopyInto(out *EmailSenderConfigStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Backends != nil {
+		in, out := &in.Backends, &out.Backends
+		*out = make([]BackendStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailSenderConfigStatus.
+func (in *EmailSenderConfigStatus) DeepCopy() *EmailSenderConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailSenderConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailSpec) DeepCopyInto(out *EmailSpec) {
+	*out = *in
+	if in.ReplyTo != nil {
+		in, out := &in.ReplyTo, &out.ReplyTo
+		*out = new(EmailAddress)
+		**out = **in
+	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]EmailAddress, len(*in))
+		copy(*out, *in)
+	}
+	if in.Cc != nil {
+		in, out := &in.Cc, &out.Cc
+		*out = make([]EmailAddress, len(*in))
+		copy(*out, *in)
+	}
+	if in.Bcc != nil {
+		in, out := &in.Bcc, &out.Bcc
+		*out = make([]EmailAddress, len(*in))
+		copy(*out, *in)
+	}
+	if in.Attachments != nil {
+		in, out := &in.Attachments, &out.Attachments
+		*out = make([]Attachment, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TemplateData != nil {
+		in, out := &in.TemplateData, &out.TemplateData
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.TemplateDataFrom != nil {
+		in, out := &in.TemplateDataFrom, &out.TemplateDataFrom
+		*out = make([]TemplateDataSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ProviderTemplate != nil {
+		in, out := &in.ProviderTemplate, &out.ProviderTemplate
+		*out = new(ProviderTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExpireAt != nil {
+		in, out := &in.ExpireAt, &out.ExpireAt
+		*out = (*in).DeepCopy()
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailSpec.
+func (in *EmailSpec) DeepCopy() *EmailSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailStatus) DeepCopyInto(out *EmailStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.FirstAttemptTime != nil {
+		in, out := &in.FirstAttemptTime, &out.FirstAttemptTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastAttemptTime != nil {
+		in, out := &in.LastAttemptTime, &out.LastAttemptTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.DeliveryAttempts != nil {
+		in, out := &in.DeliveryAttempts, &out.DeliveryAttempts
+		*out = make([]DeliveryAttempt, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Recipients != nil {
+		in, out := &in.Recipients, &out.Recipients
+		*out = make([]RecipientStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.ScheduledFor != nil {
+		in, out := &in.ScheduledFor, &out.ScheduledFor
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailStatus.
+func (in *EmailStatus) DeepCopy() *EmailStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailTemplate) DeepCopyInto(out *EmailTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailTemplate.
+func (in *EmailTemplate) DeepCopy() *EmailTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EmailTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailTemplateList) DeepCopyInto(out *EmailTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EmailTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailTemplateList.
+func (in *EmailTemplateList) DeepCopy() *EmailTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EmailTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailTemplateSpec) DeepCopyInto(out *EmailTemplateSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailTemplateSpec.
+func (in *EmailTemplateSpec) DeepCopy() *EmailTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmailTemplateStatus) DeepCopyInto(out *EmailTemplateStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmailTemplateStatus.
+func (in *EmailTemplateStatus) DeepCopy() *EmailTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EmailTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MailgunSpec) DeepCopyInto(out *MailgunSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MailgunSpec.
+func (in *MailgunSpec) DeepCopy() *MailgunSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MailgunSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostmarkSpec) DeepCopyInto(out *PostmarkSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostmarkSpec.
+func (in *PostmarkSpec) DeepCopy() *PostmarkSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PostmarkSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderBackend) DeepCopyInto(out *ProviderBackend) {
+	*out = *in
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+	in.ProviderSettings.DeepCopyInto(&out.ProviderSettings)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderBackend.
+func (in *ProviderBackend) DeepCopy() *ProviderBackend {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderBackend)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderSettings) DeepCopyInto(out *ProviderSettings) {
+	*out = *in
+	if in.Mailgun != nil {
+		in, out := &in.Mailgun, &out.Mailgun
+		*out = new(MailgunSpec)
+		**out = **in
+	}
+	if in.SMTP != nil {
+		in, out := &in.SMTP, &out.SMTP
+		*out = new(SMTPSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Postmark != nil {
+		in, out := &in.Postmark, &out.Postmark
+		*out = new(PostmarkSpec)
+		**out = **in
+	}
+	if in.SES != nil {
+		in, out := &in.SES, &out.SES
+		*out = new(SESSpec)
+		**out = **in
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderSettings.
+func (in *ProviderSettings) DeepCopy() *ProviderSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderTemplate) DeepCopyInto(out *ProviderTemplate) {
+	*out = *in
+	if in.Variables != nil {
+		in, out := &in.Variables, &out.Variables
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.Personalization != nil {
+		in, out := &in.Personalization, &out.Personalization
+		*out = make([]TemplatePersonalization, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderTemplate.
+func (in *ProviderTemplate) DeepCopy() *ProviderTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RecipientStatus) DeepCopyInto(out *RecipientStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RecipientStatus.
+func (in *RecipientStatus) DeepCopy() *RecipientStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RecipientStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.MaxAttempts != nil {
+		in, out := &in.MaxAttempts, &out.MaxAttempts
+		*out = new(int32)
+		**out = **in
+	}
+	if in.InitialBackoff != nil {
+		in, out := &in.InitialBackoff, &out.InitialBackoff
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxBackoff != nil {
+		in, out := &in.MaxBackoff, &out.MaxBackoff
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Deadline != nil {
+		in, out := &in.Deadline, &out.Deadline
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RetryableStatusCodes != nil {
+		in, out := &in.RetryableStatusCodes, &out.RetryableStatusCodes
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SESSpec) DeepCopyInto(out *SESSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SESSpec.
+func (in *SESSpec) DeepCopy() *SESSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SESSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SMTPSpec) DeepCopyInto(out *SMTPSpec) {
+	*out = *in
+	if in.ConnectTimeout != nil {
+		in, out := &in.ConnectTimeout, &out.ConnectTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SMTPSpec.
+func (in *SMTPSpec) DeepCopy() *SMTPSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SMTPSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateDataSource) DeepCopyInto(out *TemplateDataSource) {
+	*out = *in
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ObjectRef != nil {
+		in, out := &in.ObjectRef, &out.ObjectRef
+		*out = new(TemplateObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateDataSource.
+func (in *TemplateDataSource) DeepCopy() *TemplateDataSource {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateDataSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateObjectReference) DeepCopyInto(out *TemplateObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateObjectReference.
+func (in *TemplateObjectReference) DeepCopy() *TemplateObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplatePersonalization) DeepCopyInto(out *TemplatePersonalization) {
+	*out = *in
+	if in.Variables != nil {
+		in, out := &in.Variables, &out.Variables
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplatePersonalization.
+func (in *TemplatePersonalization) DeepCopy() *TemplatePersonalization {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplatePersonalization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookHeader) DeepCopyInto(out *WebhookHeader) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookHeader.
+func (in *WebhookHeader) DeepCopy() *WebhookHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookSpec) DeepCopyInto(out *WebhookSpec) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]WebhookHeader, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookSpec.
+func (in *WebhookSpec) DeepCopy() *WebhookSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// DefaultMaxAttachmentSize is the total attachment size allowed per Email
+// when EmailReconciler.MaxAttachmentSize is unset.
+const DefaultMaxAttachmentSize = 10 << 20
+
+// errSourceNotFound marks attachment sources, or keys in them, that do not
+// exist (yet). Emails wait for them rather than failing.
+var errSourceNotFound = errors.New("not found")
+
+// loadAttachments reads the attachments of an Email from their sources,
+// enforcing the total size limit. Missing ConfigMaps, Secrets and keys are
+// reported as errSourceNotFound.
+func (r *EmailReconciler) loadAttachments(ctx context.Context, email *emailv1.Email) ([]Attachment, error) {
+	limit := r.MaxAttachmentSize
+	if limit <= 0 {
+		limit = DefaultMaxAttachmentSize
+	}
+
+	var total int64
+	attachments := make([]Attachment, 0, len(email.Spec.Attachments))
+	for i, spec := range email.Spec.Attachments {
+		if spec.Filename == "" {
+			return nil, fmt.Errorf("spec.attachments[%d].filename is required", i)
+		}
+		data, err := r.attachmentData(ctx, email.Namespace, spec, limit-total)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", spec.Filename, err)
+		}
+		total += int64(len(data))
+		if total > limit {
+			return nil, fmt.Errorf("attachments exceed the %d byte size limit", limit)
+		}
+
+		a := Attachment{
+			Filename:    spec.Filename,
+			ContentType: spec.ContentType,
+			Inline:      spec.Disposition == emailv1.AttachmentDispositionInline,
+			ContentID:   spec.ContentID,
+			Data:        data,
+		}
+		if a.ContentType == "" {
+			a.ContentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+		}
+		if a.ContentType == "" {
+			a.ContentType = "application/octet-stream"
+		}
+		if a.Inline && a.ContentID == "" {
+			a.ContentID = a.Filename
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+// attachmentData reads an attachment from its single source. Files larger
+// than remaining are rejected without reading them.
+func (r *EmailReconciler) attachmentData(ctx context.Context, namespace string, spec emailv1.Attachment, remaining int64) ([]byte, error) {
+	sources := 0
+	for _, set := range []bool{spec.ConfigMapKeyRef != nil, spec.SecretKeyRef != nil, spec.FilePath != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.New("exactly one of configMapKeyRef, secretKeyRef and filePath must be set")
+	}
+
+	switch {
+	case spec.ConfigMapKeyRef != nil:
+		ref := spec.ConfigMapKeyRef
+		var cm corev1.ConfigMap
+		if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, &cm); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("ConfigMap %s %w", ref.Name, errSourceNotFound)
+			}
+			return nil, err
+		}
+		if data, ok := cm.BinaryData[ref.Key]; ok {
+			return data, nil
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			return []byte(data), nil
+		}
+		return nil, fmt.Errorf("key %s %w in ConfigMap %s", ref.Key, errSourceNotFound, ref.Name)
+	case spec.SecretKeyRef != nil:
+		ref := spec.SecretKeyRef
+		data, err := r.getSecretValues(ctx, namespace, ref.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("Secret %s %w", ref.Name, errSourceNotFound)
+			}
+			return nil, err
+		}
+		value, ok := data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %s %w in Secret %s", ref.Key, errSourceNotFound, ref.Name)
+		}
+		return value, nil
+	default:
+		path, err := r.attachmentPath(spec.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", spec.FilePath)
+		}
+		if info.Size() > remaining {
+			return nil, errors.New("file exceeds the attachment size limit")
+		}
+		return os.ReadFile(path)
+	}
+}
+
+// attachmentPath resolves a filePath attachment inside AttachmentDir,
+// refusing paths and symlinks that lead out of it.
+func (r *EmailReconciler) attachmentPath(name string) (string, error) {
+	if r.AttachmentDir == "" {
+		return "", errors.New("file attachments are disabled; set --attachment-dir to enable them")
+	}
+	root, err := filepath.EvalSymlinks(r.AttachmentDir)
+	if err != nil {
+		return "", err
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the attachment directory", name)
+	}
+	return path, nil
+}
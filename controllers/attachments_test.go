@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// attachmentMessage is contractMessage with a CSV attachment and an inline logo.
+func attachmentMessage() *Message {
+	msg := contractMessage()
+	msg.HTML = `<p>World</p><img src="cid:logo">`
+	msg.Attachments = []Attachment{
+		{Filename: "report.csv", ContentType: "text/csv", Data: []byte("a,b\n1,2\n")},
+		{Filename: "logo.png", ContentType: "image/png", Inline: true, ContentID: "logo", Data: []byte("\x89PNG")},
+	}
+	return msg
+}
+
+var _ = Describe("Attachments", func() {
+	var (
+		ctx context.Context
+		r   *EmailReconciler
+		dir string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		dir, err = os.MkdirTemp("", "attachments")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(dir, "report.pdf"), []byte("%PDF-1.4"), 0o600)).To(Succeed())
+
+		r = &EmailReconciler{
+			Client: fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "reports", Namespace: "default"},
+					Data:       map[string]string{"daily.csv": "a,b\n1,2\n"},
+					BinaryData: map[string][]byte{"logo.png": []byte("\x89PNG")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "default"},
+					Data:       map[string][]byte{"payslip.pdf": []byte("%PDF-secret")},
+				},
+			).Build(),
+			AttachmentDir: dir,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	load := func(attachments ...emailv1.Attachment) ([]Attachment, error) {
+		email := &emailv1.Email{ObjectMeta: metav1.ObjectMeta{Namespace: "default"}}
+		email.Spec.Attachments = attachments
+		return r.loadAttachments(ctx, email)
+	}
+	configMapKey := func(name, key string) *corev1.ConfigMapKeySelector {
+		return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+
+	It("reads ConfigMap, Secret and file sources and fills in defaults", func() {
+		attachments, err := load(
+			emailv1.Attachment{Filename: "daily.csv", ConfigMapKeyRef: configMapKey("reports", "daily.csv")},
+			emailv1.Attachment{Filename: "logo.png", Disposition: emailv1.AttachmentDispositionInline, ConfigMapKeyRef: configMapKey("reports", "logo.png")},
+			emailv1.Attachment{Filename: "payslip.pdf", SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "private"}, Key: "payslip.pdf"}},
+			emailv1.Attachment{Filename: "report", ContentType: "application/pdf", FilePath: "report.pdf"},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attachments).To(HaveLen(4))
+		Expect(attachments[0].Data).To(Equal([]byte("a,b\n1,2\n")))
+		Expect(attachments[0].ContentType).To(HavePrefix("text/csv"))
+		Expect(attachments[1].Inline).To(BeTrue())
+		Expect(attachments[1].ContentID).To(Equal("logo.png"))
+		Expect(attachments[1].ContentType).To(Equal("image/png"))
+		Expect(attachments[2].Data).To(Equal([]byte("%PDF-secret")))
+		Expect(attachments[3].Data).To(Equal([]byte("%PDF-1.4")))
+		Expect(attachments[3].ContentType).To(Equal("application/pdf"))
+	})
+
+	It("reports missing ConfigMaps, Secrets and keys as not found", func() {
+		_, err := load(emailv1.Attachment{Filename: "a.csv", ConfigMapKeyRef: configMapKey("missing", "daily.csv")})
+		Expect(err).To(MatchError("attachment a.csv: ConfigMap missing not found"))
+		Expect(errors.Is(err, errSourceNotFound)).To(BeTrue())
+		_, err = load(emailv1.Attachment{Filename: "a.csv", ConfigMapKeyRef: configMapKey("reports", "missing.csv")})
+		Expect(err).To(MatchError("attachment a.csv: key missing.csv not found in ConfigMap reports"))
+		Expect(errors.Is(err, errSourceNotFound)).To(BeTrue())
+		_, err = load(emailv1.Attachment{Filename: "p.pdf", SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "payslip.pdf"}})
+		Expect(errors.Is(err, errSourceNotFound)).To(BeTrue())
+	})
+
+	It("requires exactly one source", func() {
+		_, err := load(emailv1.Attachment{Filename: "x"})
+		Expect(err).To(MatchError(ContainSubstring("exactly one of")))
+	})
+
+	It("refuses files outside the attachment directory", func() {
+		_, err := load(emailv1.Attachment{Filename: "passwd", FilePath: "../../etc/passwd"})
+		Expect(err).To(MatchError(ContainSubstring("outside the attachment directory")))
+
+		Expect(os.Symlink("/etc/hostname", filepath.Join(dir, "link"))).To(Succeed())
+		_, err = load(emailv1.Attachment{Filename: "link", FilePath: "link"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("refuses files when no attachment directory is configured", func() {
+		r.AttachmentDir = ""
+		_, err := load(emailv1.Attachment{Filename: "report.pdf", FilePath: "report.pdf"})
+		Expect(err).To(MatchError(ContainSubstring("file attachments are disabled")))
+	})
+
+	It("enforces the total size limit", func() {
+		r.MaxAttachmentSize = 10
+		_, err := load(
+			emailv1.Attachment{Filename: "a.csv", ConfigMapKeyRef: configMapKey("reports", "daily.csv")},
+			emailv1.Attachment{Filename: "b.csv", ConfigMapKeyRef: configMapKey("reports", "daily.csv")},
+		)
+		Expect(err).To(MatchError(ContainSubstring("exceed the 10 byte size limit")))
+	})
+})
+
+var _ = Describe("MIME messages with attachments", func() {
+	It("nests the body, inline images and attachments", func() {
+		raw, err := buildMIME(attachmentMessage(), "<id@example.com>", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+		Expect(err).NotTo(HaveOccurred())
+
+		type part struct {
+			header textproto.MIMEHeader
+			body   []byte
+		}
+		parts := func(contentType string, body io.Reader) []part {
+			mediaType, params, err := mime.ParseMediaType(contentType)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mediaType).To(HavePrefix("multipart/"))
+			var out []part
+			mr := multipart.NewReader(body, params["boundary"])
+			for {
+				p, err := mr.NextPart()
+				if err == io.EOF {
+					return out
+				}
+				Expect(err).NotTo(HaveOccurred())
+				data, err := io.ReadAll(p)
+				Expect(err).NotTo(HaveOccurred())
+				out = append(out, part{header: p.Header, body: data})
+			}
+		}
+
+		Expect(parsed.Header.Get("Content-Type")).To(HavePrefix("multipart/mixed"))
+		mixed := parts(parsed.Header.Get("Content-Type"), parsed.Body)
+		Expect(mixed).To(HaveLen(2))
+		Expect(mixed[1].header.Get("Content-Disposition")).To(Equal("attachment; filename=report.csv"))
+		Expect(mixed[1].header.Get("Content-Transfer-Encoding")).To(Equal("base64"))
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(mixed[1].body)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("a,b\n1,2\n"))
+
+		Expect(mixed[0].header.Get("Content-Type")).To(HavePrefix("multipart/related"))
+		related := parts(mixed[0].header.Get("Content-Type"), bytes.NewReader(mixed[0].body))
+		Expect(related).To(HaveLen(2))
+		Expect(related[0].header.Get("Content-Type")).To(HavePrefix("multipart/alternative"))
+		Expect(related[1].header.Get("Content-ID")).To(Equal("<logo>"))
+		Expect(related[1].header.Get("Content-Disposition")).To(HavePrefix("inline"))
+	})
+})
+
+var _ = Describe("Provider attachments", func() {
+	It("sends SendGrid attachments with inline content ids", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			var body sendGridMessage
+			decodeJSON(r, &body)
+			Expect(body.Attachments).To(Equal([]sendGridAttachment{
+				{Content: base64.StdEncoding.EncodeToString([]byte("a,b\n1,2\n")), Type: "text/csv", Filename: "report.csv", Disposition: "attachment"},
+				{Content: base64.StdEncoding.EncodeToString([]byte("\x89PNG")), Type: "image/png", Filename: "logo.png", Disposition: "inline", ContentID: "logo"},
+			}))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		p := &sendGridProvider{apiKey: "key", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), attachmentMessage())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("uploads Mailgun attachments and inline files as multipart form data", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.ParseMultipartForm(1 << 20)).To(Succeed())
+			Expect(r.MultipartForm.Value["to"]).To(Equal([]string{`"Recipient" <recipient@example.com>`}))
+			Expect(r.MultipartForm.File["attachment"]).To(HaveLen(1))
+			Expect(r.MultipartForm.File["attachment"][0].Filename).To(Equal("report.csv"))
+			Expect(r.MultipartForm.File["inline"]).To(HaveLen(1))
+			Expect(r.MultipartForm.File["inline"][0].Filename).To(Equal("logo"))
+			_, _ = w.Write([]byte(`{"id":"<1@mg.example.com>"}`))
+		}))
+		defer server.Close()
+
+		p := &mailgunProvider{apiKey: "key", domain: "mg.example.com", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), attachmentMessage())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends Postmark attachments with cid content ids", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			var body postmarkMessage
+			decodeJSON(r, &body)
+			Expect(body.Attachments).To(HaveLen(2))
+			Expect(body.Attachments[0].ContentID).To(BeEmpty())
+			Expect(body.Attachments[1].ContentID).To(Equal("cid:logo"))
+			_, _ = w.Write([]byte(`{"MessageID":"pm-1","ErrorCode":0}`))
+		}))
+		defer server.Close()
+
+		p := &postmarkProvider{serverToken: "token", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), attachmentMessage())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends SES messages with attachments as raw MIME", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			var body sesSendEmailRequest
+			decodeJSON(r, &body)
+			Expect(body.Content.Simple).To(BeNil())
+			Expect(body.Content.Raw).NotTo(BeNil())
+			Expect(string(body.Content.Raw.Data)).To(ContainSubstring(`filename=report.csv`))
+			Expect(body.Destination.BccAddresses).To(Equal([]string{"audit@example.com"}))
+			_, _ = w.Write([]byte(`{"MessageId":"ses-1"}`))
+		}))
+		defer server.Close()
+
+		p := &sesProvider{region: "eu-west-1", endpoint: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), attachmentMessage())
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"hash/fnv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// maxDeliveryAttempts bounds the attempt history kept in Email status.
+const maxDeliveryAttempts = 20
+
+// defaultBackendName names the single backend of a config without backends.
+const defaultBackendName = "default"
+
+// senderBackend is a resolved entry of an EmailSenderConfig's failover chain.
+type senderBackend struct {
+	name      string
+	secretRef string
+	settings  emailv1.ProviderSettings
+	weight    int32
+}
+
+// spec returns the sender config spec as seen by this backend's provider.
+func (b senderBackend) spec(spec emailv1.EmailSenderConfigSpec) emailv1.EmailSenderConfigSpec {
+	spec.ProviderSettings = b.settings
+	spec.Backends = nil
+	return spec
+}
+
+// configBackends returns the backends of config in the order they are tried
+// for email.
+func configBackends(config *emailv1.EmailSenderConfig, email *emailv1.Email) []senderBackend {
+	return weightedOrder(backendChain(config), string(email.UID))
+}
+
+// backendChain returns the backends of config in failover order. A config
+// without backends has a single backend built from its top-level provider
+// settings.
+func backendChain(config *emailv1.EmailSenderConfig) []senderBackend {
+	if len(config.Spec.Backends) == 0 {
+		return []senderBackend{{
+			name:      defaultBackendName,
+			secretRef: config.Spec.ApiTokenSecretRef,
+			settings:  config.Spec.ProviderSettings,
+		}}
+	}
+
+	backends := make([]senderBackend, 0, len(config.Spec.Backends))
+	for _, b := range config.Spec.Backends {
+		secretRef := b.SecretRef
+		if secretRef == "" {
+			secretRef = config.Spec.ApiTokenSecretRef
+		}
+		var weight int32
+		if b.Weight != nil {
+			weight = *b.Weight
+		}
+		backends = append(backends, senderBackend{
+			name:      b.Name,
+			secretRef: secretRef,
+			settings:  b.ProviderSettings,
+			weight:    weight,
+		})
+	}
+	return backends
+}
+
+// weightedOrder moves the backend picked for key by weight to the front,
+// keeping the others in failover order. The pick depends only on key and the
+// weights, so every retry of an Email starts at the same backend.
+func weightedOrder(backends []senderBackend, key string) []senderBackend {
+	var total uint64
+	for _, b := range backends {
+		if b.weight > 0 {
+			total += uint64(b.weight)
+		}
+	}
+	if total == 0 {
+		return backends
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	point := h.Sum64() % total
+
+	for i, b := range backends {
+		if b.weight <= 0 {
+			continue
+		}
+		if point < uint64(b.weight) {
+			ordered := make([]senderBackend, 0, len(backends))
+			ordered = append(ordered, b)
+			ordered = append(ordered, backends[:i]...)
+			return append(ordered, backends[i+1:]...)
+		}
+		point -= uint64(b.weight)
+	}
+	return backends
+}
+
+// startAt moves the named backend to the front, keeping the others in order.
+func startAt(backends []senderBackend, name string) []senderBackend {
+	for i, b := range backends {
+		if b.name == name {
+			ordered := make([]senderBackend, 0, len(backends))
+			ordered = append(ordered, b)
+			ordered = append(ordered, backends[:i]...)
+			return append(ordered, backends[i+1:]...)
+		}
+	}
+	return backends
+}
+
+// countSend adds a send attempt through the named backend, and its error if
+// it failed, to the sender config's status, retrying on conflicts with
+// concurrent reconciles.
+func (r *EmailReconciler) countSend(ctx context.Context, key client.ObjectKey, backend string, sendErr error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var config emailv1.EmailSenderConfig
+		if err := r.Get(ctx, key, &config); err != nil {
+			return err
+		}
+		status := backendStatus(&config.Status, backend)
+		if sendErr == nil {
+			status.Sent++
+			status.LastError = ""
+		} else {
+			status.Failed++
+			status.LastError = sendErr.Error()
+		}
+		setBackendConditions(&config)
+		return r.Status().Update(ctx, &config)
+	})
+}
+
+// backendStatus returns the status entry for the named backend, adding one if
+// needed.
+func backendStatus(status *emailv1.EmailSenderConfigStatus, name string) *emailv1.BackendStatus {
+	for i := range status.Backends {
+		if status.Backends[i].Name == name {
+			return &status.Backends[i]
+		}
+	}
+	status.Backends = append(status.Backends, emailv1.BackendStatus{Name: name})
+	return &status.Backends[len(status.Backends)-1]
+}
+
+// recordAttempt appends a delivery attempt to the Email status.
+func recordAttempt(email *emailv1.Email, b senderBackend, err error) {
+	attempt := emailv1.DeliveryAttempt{
+		Backend:  b.name,
+		Provider: providerName(b.settings),
+		Time:     metav1.Now(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	attempts := append(email.Status.DeliveryAttempts, attempt)
+	if len(attempts) > maxDeliveryAttempts {
+		attempts = attempts[len(attempts)-maxDeliveryAttempts:]
+	}
+	email.Status.DeliveryAttempts = attempts
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Weighted backends", func() {
+	weighted := func(weights ...int32) *emailv1.EmailSenderConfig {
+		config := &emailv1.EmailSenderConfig{}
+		for i, w := range weights {
+			w := w
+			config.Spec.Backends = append(config.Spec.Backends, emailv1.ProviderBackend{
+				Name:   fmt.Sprintf("backend-%d", i),
+				Weight: &w,
+			})
+		}
+		return config
+	}
+
+	emailWithUID := func(uid string) *emailv1.Email {
+		email := &emailv1.Email{}
+		email.UID = types.UID("email-" + uid)
+		return email
+	}
+
+	names := func(backends []senderBackend) []string {
+		var out []string
+		for _, b := range backends {
+			out = append(out, b.name)
+		}
+		return out
+	}
+
+	It("keeps list order when no backend has a weight", func() {
+		config := &emailv1.EmailSenderConfig{}
+		config.Spec.Backends = []emailv1.ProviderBackend{{Name: "a"}, {Name: "b"}}
+		Expect(names(configBackends(config, emailWithUID("1")))).To(Equal([]string{"a", "b"}))
+	})
+
+	It("picks the same backend for the same Email every time", func() {
+		config := weighted(50, 50)
+		first := names(configBackends(config, emailWithUID("stable")))
+		for i := 0; i < 10; i++ {
+			Expect(names(configBackends(config, emailWithUID("stable")))).To(Equal(first))
+		}
+	})
+
+	It("splits traffic by weight and keeps the rest as failover", func() {
+		config := weighted(90, 10, 0)
+		counts := map[string]int{}
+		for i := 0; i < 2000; i++ {
+			order := names(configBackends(config, emailWithUID(fmt.Sprint(i))))
+			Expect(order).To(HaveLen(3))
+			Expect(order).To(ContainElements("backend-0", "backend-1", "backend-2"))
+			counts[order[0]]++
+		}
+		Expect(counts["backend-2"]).To(BeZero())
+		Expect(counts["backend-1"]).To(BeNumerically("~", 200, 60))
+		Expect(counts["backend-0"]).To(BeNumerically("~", 1800, 60))
+	})
+})
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var captureInboxTemplate = template.Must(template.New("inbox").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Captured email</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.4em; border-bottom: 1px solid #ddd; }
+iframe { width: 100%; height: 30em; border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+{{- if .Message }}
+{{- with .Message }}
+<p><a href="./">&larr; Inbox</a></p>
+<h1>{{ .Subject }}</h1>
+<table>
+<tr><th>From</th><td>{{ .From }}</td></tr>
+{{- with .ReplyTo }}
+<tr><th>Reply-To</th><td>{{ . }}</td></tr>
+{{- end }}
+<tr><th>To</th><td>{{ range $i, $to := .To }}{{ if $i }}, {{ end }}{{ $to }}{{ end }}</td></tr>
+{{- if .Cc }}
+<tr><th>Cc</th><td>{{ range $i, $cc := .Cc }}{{ if $i }}, {{ end }}{{ $cc }}{{ end }}</td></tr>
+{{- end }}
+{{- if .Bcc }}
+<tr><th>Bcc</th><td>{{ range $i, $bcc := .Bcc }}{{ if $i }}, {{ end }}{{ $bcc }}{{ end }}</td></tr>
+{{- end }}
+<tr><th>Message-ID</th><td>{{ .ID }}</td></tr>
+{{- if .Attachments }}
+<tr><th>Attachments</th><td>{{ range $i, $a := .Attachments }}{{ if $i }}, {{ end }}{{ $a.Filename }} ({{ $a.ContentType }}, {{ len $a.Data }} bytes){{ end }}</td></tr>
+{{- end }}
+<tr><th>Captured</th><td>{{ .CapturedAt.Format "2006-01-02 15:04:05 MST" }}</td></tr>
+</table>
+<p>
+{{- if .HTML }}<a href="message/html?id={{ .ID }}">HTML</a> | {{ end -}}
+<a href="message/text?id={{ .ID }}">Text</a> |
+<a href="message/raw?id={{ .ID }}">Raw MIME</a>
+</p>
+{{- if .HTML }}
+<iframe sandbox src="message/html?id={{ .ID }}"></iframe>
+{{- else }}
+<pre>{{ .Text }}</pre>
+{{- end }}
+{{- end }}
+{{- else }}
+<h1>Captured email</h1>
+<table>
+<tr><th>Captured</th><th>From</th><th>To</th><th>Subject</th></tr>
+{{- range .Messages }}
+<tr>
+<td>{{ .CapturedAt.Format "2006-01-02 15:04:05" }}</td>
+<td>{{ .From }}</td>
+<td>{{ range $i, $to := .To }}{{ if $i }}, {{ end }}{{ $to }}{{ end }}</td>
+<td><a href="message?id={{ .ID }}">{{ .Subject }}</a></td>
+</tr>
+{{- else }}
+<tr><td colspan="4">No messages captured yet.</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
+
+// ServeHTTP serves an inbox of captured messages:
+//
+//	/                       list of messages, newest first
+//	/message?id=ID          message details
+//	/message/html?id=ID     HTML body
+//	/message/text?id=ID     plain text body
+//	/message/raw?id=ID      raw MIME message
+func (s *CaptureStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path == "/" {
+		s.render(w, map[string]interface{}{"Messages": s.List()})
+		return
+	}
+
+	m, ok := s.Get(r.URL.Query().Get("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/message":
+		s.render(w, map[string]interface{}{"Message": m})
+	case "/message/html":
+		// The body is untrusted, so keep it away from the inbox's origin.
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(m.HTML))
+	case "/message/text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(m.Text))
+	case "/message/raw":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(m.Raw)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *CaptureStore) render(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := captureInboxTemplate.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CaptureServer serves a CaptureStore's inbox over HTTP. It implements
+// manager.Runnable so it shares the manager's lifecycle.
+type CaptureServer struct {
+	Addr  string
+	Store *CaptureStore
+}
+
+// Start serves the inbox until ctx is cancelled.
+func (s *CaptureServer) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("capture-inbox")
+	srv := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.Store,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info("Serving captured email inbox", "addr", s.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// NeedLeaderElection serves the inbox from the leader only. Emails are
+// captured by the replica that reconciles them, which is the leader, so the
+// inbox of any other replica would always be empty.
+func (s *CaptureServer) NeedLeaderElection() bool {
+	return true
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// setCondition sets a condition of the given type, keeping its transition
+// time unless its status changes.
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, ok bool, reason, message string) {
+	status := metav1.ConditionFalse
+	if ok {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// reasonSenderConfigNotReady is the reason of the Ready condition of an
+// Email waiting for its sender config to be verified.
+const reasonSenderConfigNotReady = "SenderConfigNotReady"
+
+// setEmailConditions derives the Email's conditions from its phase and
+// records the generation they were written for. Every condition's reason
+// is the phase.
+func setEmailConditions(email *emailv1.Email) {
+	status := &email.Status
+	status.ObservedGeneration = email.Generation
+	phase := status.DeliveryStatus
+	if phase == "" {
+		phase = emailv1.EmailPhasePending
+	}
+	reason := string(phase)
+
+	message := status.Error
+	switch phase {
+	case emailv1.EmailPhaseSent:
+		message = fmt.Sprintf("Sent through backend %s as message %s", status.Backend, status.MessageID)
+	case emailv1.EmailPhaseScheduled:
+		if status.ScheduledFor != nil {
+			message = fmt.Sprintf("Held until %s", status.ScheduledFor.UTC().Format(time.RFC3339))
+		}
+	case emailv1.EmailPhaseSending:
+		message = fmt.Sprintf("Attempt %s is being handed to backend %s", status.AttemptID, status.Backend)
+	case emailv1.EmailPhaseRetrying:
+		if status.NextRetryTime != nil {
+			message = fmt.Sprintf("Attempt %d failed, retrying at %s: %s", status.Attempts, status.NextRetryTime.UTC().Format(time.RFC3339), status.Error)
+		}
+	case emailv1.EmailPhaseDryRun:
+		message = "Rendered without sending"
+	}
+
+	setCondition(&status.Conditions, email.Generation, emailv1.ConditionReady, phase == emailv1.EmailPhaseSent || phase == emailv1.EmailPhaseDryRun, reason, message)
+	setCondition(&status.Conditions, email.Generation, emailv1.ConditionSent, phase == emailv1.EmailPhaseSent, reason, message)
+	setCondition(&status.Conditions, email.Generation, emailv1.ConditionRetrying, phase == emailv1.EmailPhaseRetrying, reason, message)
+
+	// Emails that were delivered to only some recipients are degraded too.
+	var rejected []string
+	for _, rcpt := range status.Recipients {
+		if !rcpt.Accepted {
+			rejected = append(rejected, rcpt.Email)
+		}
+	}
+	switch {
+	case phase == emailv1.EmailPhaseFailed || phase == emailv1.EmailPhaseExpired:
+		setCondition(&status.Conditions, email.Generation, emailv1.ConditionDegraded, true, reason, message)
+	case len(rejected) > 0 && phase == emailv1.EmailPhaseSent:
+		setCondition(&status.Conditions, email.Generation, emailv1.ConditionDegraded, true, "RecipientsRejected",
+			fmt.Sprintf("Rejected recipients: %s", strings.Join(rejected, ", ")))
+	default:
+		setCondition(&status.Conditions, email.Generation, emailv1.ConditionDegraded, false, reason, message)
+	}
+}
+
+// setBackendConditions sets the Degraded condition of an EmailSenderConfig
+// from the last result of each of its backends.
+func setBackendConditions(config *emailv1.EmailSenderConfig) {
+	var failing []string
+	for _, b := range config.Status.Backends {
+		if b.LastError != "" {
+			failing = append(failing, fmt.Sprintf("backend %s: %s", b.Name, b.LastError))
+		}
+	}
+	if len(failing) > 0 {
+		setCondition(&config.Status.Conditions, config.Generation, emailv1.ConditionDegraded, true, "BackendFailing", strings.Join(failing, "; "))
+		return
+	}
+	setCondition(&config.Status.Conditions, config.Generation, emailv1.ConditionDegraded, false, "BackendsHealthy", "Every backend accepted its last email")
+}
+
+// senderConfigReady reports whether the sender config was verified for its
+// current generation and, if not, why.
+func senderConfigReady(config *emailv1.EmailSenderConfig) (bool, string) {
+	ready := meta.FindStatusCondition(config.Status.Conditions, emailv1.ConditionReady)
+	switch {
+	case ready == nil || ready.ObservedGeneration != config.Generation:
+		return false, "it has not been verified yet"
+	case ready.Status != metav1.ConditionTrue:
+		return false, fmt.Sprintf("%s: %s", ready.Reason, ready.Message)
+	}
+	return true, ""
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Email conditions", func() {
+	conditionStatus := func(email *emailv1.Email, conditionType string) metav1.ConditionStatus {
+		condition := meta.FindStatusCondition(email.Status.Conditions, conditionType)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.ObservedGeneration).To(Equal(email.Generation))
+		return condition.Status
+	}
+
+	It("reports new Emails as pending", func() {
+		email := &emailv1.Email{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+		setEmailConditions(email)
+		Expect(email.Status.ObservedGeneration).To(Equal(int64(2)))
+		Expect(email.Status.Conditions).To(HaveLen(4))
+		for _, condition := range email.Status.Conditions {
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("Pending"))
+		}
+	})
+
+	It("follows the Email through retries to being sent", func() {
+		email := &emailv1.Email{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+		email.Status.DeliveryStatus = emailv1.EmailPhaseRetrying
+		email.Status.Attempts = 1
+		email.Status.Error = "throttled"
+		email.Status.NextRetryTime = &metav1.Time{Time: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)}
+		setEmailConditions(email)
+		Expect(conditionStatus(email, emailv1.ConditionRetrying)).To(Equal(metav1.ConditionTrue))
+		Expect(conditionStatus(email, emailv1.ConditionReady)).To(Equal(metav1.ConditionFalse))
+		Expect(meta.FindStatusCondition(email.Status.Conditions, emailv1.ConditionRetrying).Message).To(
+			Equal("Attempt 1 failed, retrying at 2024-05-01T08:00:00Z: throttled"))
+
+		email.Status.DeliveryStatus = emailv1.EmailPhaseSent
+		email.Status.Backend = "default"
+		email.Status.MessageID = "id"
+		setEmailConditions(email)
+		Expect(conditionStatus(email, emailv1.ConditionRetrying)).To(Equal(metav1.ConditionFalse))
+		Expect(conditionStatus(email, emailv1.ConditionSent)).To(Equal(metav1.ConditionTrue))
+		Expect(conditionStatus(email, emailv1.ConditionReady)).To(Equal(metav1.ConditionTrue))
+		Expect(conditionStatus(email, emailv1.ConditionDegraded)).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("reports failed Emails and rejected recipients as degraded", func() {
+		email := &emailv1.Email{}
+		email.Status.DeliveryStatus = emailv1.EmailPhaseFailed
+		email.Status.Error = "boom"
+		setEmailConditions(email)
+		degraded := meta.FindStatusCondition(email.Status.Conditions, emailv1.ConditionDegraded)
+		Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+		Expect(degraded.Reason).To(Equal("Failed"))
+		Expect(degraded.Message).To(Equal("boom"))
+
+		email.Status.DeliveryStatus = emailv1.EmailPhaseSent
+		email.Status.Error = ""
+		email.Status.Recipients = []emailv1.RecipientStatus{
+			{Email: "recipient@example.com", Accepted: true},
+			{Email: "gone@example.com", Error: "550 No such user"},
+		}
+		setEmailConditions(email)
+		degraded = meta.FindStatusCondition(email.Status.Conditions, emailv1.ConditionDegraded)
+		Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+		Expect(degraded.Reason).To(Equal("RecipientsRejected"))
+		Expect(degraded.Message).To(Equal("Rejected recipients: gone@example.com"))
+		Expect(conditionStatus(email, emailv1.ConditionSent)).To(Equal(metav1.ConditionTrue))
+	})
+})
@@ -2,17 +2,22 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
-	"github.com/mailersend/mailersend-go"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
 )
@@ -20,13 +25,28 @@ import (
 // EmailReconciler reconciles an Email object
 type EmailReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Providers resolves provider names to implementations. DefaultProviders
+	// is used when nil.
+	Providers *ProviderRegistry
+
+	// AttachmentDir is the directory filePath attachments are read from.
+	// File attachments are refused when empty.
+	AttachmentDir string
+	// MaxAttachmentSize caps the total size of an Email's attachments in
+	// bytes. DefaultMaxAttachmentSize is used when zero.
+	MaxAttachmentSize int64
 }
 
 //+kubebuilder:rbac:groups=email.mailerlitetask.com,resources=emails,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=email.mailerlitetask.com,resources=emails/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=email.mailerlitetask.com,resources=emails/finalizers,verbs=update
+//+kubebuilder:rbac:groups=email.mailerlitetask.com,resources=emailtemplates,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *EmailReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
@@ -45,138 +65,398 @@ func (r *EmailReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	log.Info("Email resource found", "email", email)
 
 	// Check if the email has already been sent
-	if email.Status.DeliveryStatus == "Sent" {
+	switch {
+	case email.Status.DeliveryStatus == emailv1.EmailPhaseSent:
 		log.Info("Email already sent, skipping", "email", email.Name)
 		return ctrl.Result{}, nil
+	case email.Status.DeliveryStatus == emailv1.EmailPhaseFailed:
+		log.Info("Email already failed, skipping", "email", email.Name)
+		return ctrl.Result{}, nil
+	case email.Status.DeliveryStatus == emailv1.EmailPhaseDryRun && email.Status.ObservedGeneration == email.Generation:
+		// Dry runs, whether asked for or through a provider that never
+		// sends, are rendered again only when the spec changes.
+		log.Info("Email already rendered in dry run, skipping", "email", email.Name)
+		return ctrl.Result{}, nil
+	}
+
+	// Give up on emails that were not sent in time. One with an attempt in
+	// doubt is checked with its provider first, when sending.
+	now := time.Now()
+	if expired(&email, now) && email.Status.AttemptID == "" {
+		if email.Status.DeliveryStatus == emailv1.EmailPhaseExpired {
+			return ctrl.Result{}, nil
+		}
+		log.Info("Email expired before it was sent", "email", email.Name, "expireAt", email.Spec.ExpireAt)
+		email.Status.DeliveryStatus = emailv1.EmailPhaseExpired
+		email.Status.Error = expiredError(&email).Error()
+		email.Status.NextRetryTime = nil
+		r.event(&email, corev1.EventTypeWarning, "Expired", email.Status.Error)
+		if err := r.updateStatus(ctx, &email); err != nil {
+			log.Error(err, "Failed to update Email status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Wait out the backoff of emails that are being retried
+	if email.Status.DeliveryStatus == emailv1.EmailPhaseRetrying && email.Status.NextRetryTime != nil && now.Before(email.Status.NextRetryTime.Time) {
+		return ctrl.Result{RequeueAfter: email.Status.NextRetryTime.Sub(now)}, nil
 	}
 
 	// Fetch the EmailSenderConfig instance
 	var emailSenderConfig emailv1.EmailSenderConfig
 	if err := r.Get(ctx, client.ObjectKey{Name: email.Spec.SenderConfigRef, Namespace: req.Namespace}, &emailSenderConfig); err != nil {
 		log.Error(err, "Failed to get EmailSenderConfig", "EmailSenderConfig", email.Spec.SenderConfigRef)
-		email.Status.DeliveryStatus = "Failed"
+		email.Status.DeliveryStatus = emailv1.EmailPhasePending
 		email.Status.Error = "EmailSenderConfig not found"
-		if updateErr := r.Status().Update(ctx, &email); updateErr != nil {
+		if updateErr := r.updateStatus(ctx, &email); updateErr != nil {
 			log.Error(updateErr, "Failed to update Email status")
 		}
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, err
 	}
 
 	log.Info("EmailSenderConfig found", "EmailSenderConfig", emailSenderConfig)
 
-	// Fetch the API token and from-email from the secret
-	apiToken, fromEmail, err := getSecretValues(req.Namespace, emailSenderConfig.Spec.ApiTokenSecretRef)
+	// Wait for the sender config to be verified, dry runs included. The
+	// Email keeps its phase, so a retry or an attempt in doubt picks up
+	// where it left off, and is looked at again no later than it expires.
+	if ready, reason := senderConfigReady(&emailSenderConfig); !ready {
+		log.Info("EmailSenderConfig is not ready, waiting", "EmailSenderConfig", emailSenderConfig.Name, "reason", reason)
+		if email.Status.DeliveryStatus == "" {
+			email.Status.DeliveryStatus = emailv1.EmailPhasePending
+		}
+		email.Status.Error = fmt.Sprintf("EmailSenderConfig %s is not ready: %s", emailSenderConfig.Name, reason)
+		setEmailConditions(&email)
+		setCondition(&email.Status.Conditions, email.Generation, emailv1.ConditionReady, false, reasonSenderConfigNotReady, email.Status.Error)
+		if err := r.Status().Update(ctx, &email); err != nil {
+			log.Error(err, "Failed to update Email status")
+			return ctrl.Result{}, err
+		}
+		requeueAfter := notReadyInterval
+		if email.Spec.ExpireAt != nil {
+			if untilExpiry := email.Spec.ExpireAt.Sub(now); untilExpiry > 0 && untilExpiry < requeueAfter {
+				requeueAfter = untilExpiry
+			}
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// Fetch the provider credentials from the secret
+	secret, err := r.getSecretValues(ctx, req.Namespace, emailSenderConfig.Spec.ApiTokenSecretRef)
 	if err != nil {
-		log.Error(err, "Failed to get API token or from-email from secret")
-		email.Status.DeliveryStatus = "Failed"
-		email.Status.Error = "Failed to get API token or from-email from secret"
-		if updateErr := r.Status().Update(ctx, &email); updateErr != nil {
+		log.Error(err, "Failed to get credentials from secret")
+		email.Status.DeliveryStatus = emailv1.EmailPhasePending
+		email.Status.Error = "Failed to get credentials from secret"
+		if updateErr := r.updateStatus(ctx, &email); updateErr != nil {
 			log.Error(updateErr, "Failed to update Email status")
 		}
 		return ctrl.Result{}, err
 	}
 
 	// Send the email
-	log.Info("Sending email", "recipient", email.Spec.RecipientEmail)
-	deliveryStatus, messageID, err := sendEmail(email, apiToken, fromEmail)
-	if err != nil {
-		email.Status.DeliveryStatus = "Failed"
-		email.Status.Error = err.Error()
+	policy, err := newRetryPolicy(emailSenderConfig.Spec.RetryPolicy, email.Spec.RetryPolicy)
+	phase, messageID, sendErr := emailv1.EmailPhaseFailed, "", err
+	if err == nil {
+		log.Info("Sending email", "to", email.Spec.To, "recipientEmail", email.Spec.RecipientEmail)
+		phase, messageID, sendErr = r.sendEmail(ctx, &email, &emailSenderConfig, secret, policy)
+	}
+	email.Status.NextRetryTime = nil
+
+	var requeueAfter time.Duration
+	switch phase {
+	case emailv1.EmailPhaseScheduled:
+		// Scheduled emails come back when they are due.
+		requeueAfter = email.Status.ScheduledFor.Sub(now)
+	case emailv1.EmailPhaseRetrying:
+		// Back off, unless the provider asked for a longer wait, and come
+		// back no later than the email expires.
+		requeueAfter = policy.backoff(email.Status.Attempts)
+		if retryable := asRetryable(sendErr); retryable != nil && retryable.RetryAfter > requeueAfter {
+			requeueAfter = retryable.RetryAfter
+		}
+		if email.Spec.ExpireAt != nil && email.Spec.ExpireAt.Sub(now) < requeueAfter {
+			requeueAfter = email.Spec.ExpireAt.Sub(now)
+		}
+		if email.Status.Attempts >= policy.maxAttempts {
+			phase, requeueAfter = emailv1.EmailPhaseFailed, 0
+			sendErr = fmt.Errorf("giving up after attempt %d: %w", email.Status.Attempts, sendErr)
+			break
+		}
+		if policy.deadline > 0 && email.Status.FirstAttemptTime != nil && now.Add(requeueAfter).After(email.Status.FirstAttemptTime.Add(policy.deadline)) {
+			phase, requeueAfter = emailv1.EmailPhaseFailed, 0
+			sendErr = fmt.Errorf("giving up after attempt %d, retrying would pass the %s deadline: %w", email.Status.Attempts, policy.deadline, sendErr)
+			break
+		}
+		email.Status.NextRetryTime = &metav1.Time{Time: now.Add(requeueAfter)}
+		log.Error(sendErr, "Retryable error sending email, backing off", "attempts", email.Status.Attempts, "retryAfter", requeueAfter)
+	}
+
+	email.Status.DeliveryStatus = phase
+	if sendErr != nil {
+		email.Status.Error = sendErr.Error()
 	} else {
-		email.Status.DeliveryStatus = deliveryStatus
 		email.Status.MessageID = messageID
 		email.Status.Error = ""
 	}
 
 	// Update the status of the Email resource
-	if err := r.Status().Update(ctx, &email); err != nil {
+	if err := r.updateStatus(ctx, &email); err != nil {
 		log.Error(err, "Failed to update Email status")
 		return ctrl.Result{}, err
 	}
 
 	log.Info("Email status updated successfully", "status", email.Status)
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func sendEmail(email emailv1.Email, apiToken, fromEmail string) (string, string, error) {
-	return sendEmailUsingMailerSend(email, apiToken, fromEmail)
-}
-
-func sendEmailUsingMailerSend(email emailv1.Email, apiToken, fromEmail string) (string, string, error) {
-	log := log.Log
-
-	log.Info("Creating MailerSend client")
-	ms := mailersend.NewMailersend(apiToken)
-
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	from := mailersend.From{
-		Name:  "MailerSend",
-		Email: fromEmail,
+// sendEmail sends the email through the sender config's backends, starting
+// at the weighted pick and moving on to the next backend only when one fails
+// with an error the retry policy retries.
+func (r *EmailReconciler) sendEmail(ctx context.Context, email *emailv1.Email, config *emailv1.EmailSenderConfig, secret map[string][]byte, policy retryPolicy) (emailv1.EmailPhase, string, error) {
+	log := log.FromContext(ctx)
+	sendAt, err := sendTime(email.Spec)
+	if err != nil {
+		return emailv1.EmailPhaseFailed, "", err
+	}
+	rendered, err := r.renderEmail(ctx, email)
+	if err != nil {
+		return emailv1.EmailPhaseFailed, "", err
+	}
+	if rendered, err = r.renderBodyFormat(ctx, rendered, config); err != nil {
+		return emailv1.EmailPhaseFailed, "", err
+	}
+	from, err := senderEmail(email, config.Spec, secret)
+	if err != nil {
+		return emailv1.EmailPhaseFailed, "", err
+	}
+	msg, err := newMessage(rendered, from)
+	if err != nil {
+		return emailv1.EmailPhaseFailed, "", err
+	}
+	if err := applySenderDefaults(msg, config.Spec); err != nil {
+		return emailv1.EmailPhaseFailed, "", err
+	}
+	if msg.Attachments, err = r.loadAttachments(ctx, email); err != nil {
+		// A source that is not there yet may still be created.
+		if errors.Is(err, errSourceNotFound) {
+			return emailv1.EmailPhaseRetrying, "", err
+		}
+		return emailv1.EmailPhaseFailed, "", err
 	}
 
-	recipients := []mailersend.Recipient{
-		{
-			Name:  "Recipient",
-			Email: email.Spec.RecipientEmail,
-		},
+	// A try counts once it reaches a provider, however many backends it
+	// goes through.
+	counted := false
+	countAttempt := func() {
+		if counted {
+			return
+		}
+		counted = true
+		now := metav1.Now()
+		email.Status.Attempts++
+		email.Status.LastAttemptTime = &now
+		if email.Status.FirstAttemptTime == nil {
+			email.Status.FirstAttemptTime = &now
+		}
 	}
 
-	subject := email.Spec.Subject
-	text := email.Spec.Body
-	html := email.Spec.Body
+	var lastErr, retryErr error
+	backends := configBackends(config, email)
+	if email.Status.AttemptID != "" {
+		// Ask the backend that may already have the email before any
+		// other is given it.
+		backends = startAt(backends, email.Status.Backend)
+	}
+	for _, b := range backends {
+		backendSecret := secret
+		if b.secretRef != config.Spec.ApiTokenSecretRef {
+			var err error
+			if backendSecret, err = r.getSecretValues(ctx, email.Namespace, b.secretRef); err != nil {
+				lastErr = fmt.Errorf("backend %s: failed to get secret %s: %w", b.name, b.secretRef, err)
+				recordAttempt(email, b, lastErr)
+				continue
+			}
+		}
 
-	message := ms.Email.NewMessage()
+		provider, err := r.providers().New(providerName(b.settings), ProviderConfig{
+			Spec:   b.spec(config.Spec),
+			Secret: backendSecret,
+		})
+		if err != nil {
+			lastErr = fmt.Errorf("backend %s: %w", b.name, err)
+			recordAttempt(email, b, lastErr)
+			continue
+		}
 
-	message.SetFrom(from)
-	message.SetRecipients(recipients)
-	message.SetSubject(subject)
-	message.SetHTML(html)
-	message.SetText(text)
+		if email.Spec.DryRun || isDryRun(provider) {
+			return r.dryRun(ctx, email, provider, msg)
+		}
+		if len(msg.To) == 0 && requiresTo(provider) {
+			lastErr = fmt.Errorf("backend %s: provider %s needs at least one To recipient", b.name, provider.Name())
+			recordAttempt(email, b, lastErr)
+			continue
+		}
+		if msg.Template != nil && !supportsTemplates(provider) {
+			lastErr = fmt.Errorf("backend %s: provider %s does not support provider templates", b.name, provider.Name())
+			recordAttempt(email, b, lastErr)
+			continue
+		}
+		// Hand emails that are not due yet to providers that can hold them,
+		// and wait for the rest.
+		msg.SendAt = time.Time{}
+		if wait := time.Until(sendAt); wait > 0 {
+			email.Status.ScheduledFor = &metav1.Time{Time: sendAt}
+			if !canSchedule(provider, wait) {
+				if email.Status.DeliveryStatus != emailv1.EmailPhaseScheduled {
+					r.event(email, corev1.EventTypeNormal, "Scheduled", fmt.Sprintf("Holding email until %s", sendAt.Format(time.RFC3339)))
+				}
+				return emailv1.EmailPhaseScheduled, "", nil
+			}
+			msg.SendAt = sendAt
+		}
 
-	log.Info("Sending email with MailerSend", "from", from, "recipients", recipients, "subject", subject, "text", text, "html", html)
+		// Resolve an attempt through this backend whose outcome was never
+		// recorded, reusing its key if it has to be sent again.
+		key := string(uuid.NewUUID())
+		if email.Status.AttemptID != "" && email.Status.Backend == b.name {
+			key = email.Status.AttemptID
+			countAttempt()
+			messageID, sent, err := r.checkSent(ctx, email, provider, key, policy)
+			if err != nil {
+				return emailv1.EmailPhaseRetrying, "", fmt.Errorf("backend %s: %w", b.name, err)
+			}
+			if sent {
+				log.Info("In-doubt attempt was sent", "attemptID", key, "messageID", messageID)
+				email.Status.AttemptID = ""
+				return emailv1.EmailPhaseSent, messageID, nil
+			}
+		}
+		if expired(email, time.Now()) {
+			email.Status.AttemptID = ""
+			err := expiredError(email)
+			r.event(email, corev1.EventTypeWarning, "Expired", err.Error())
+			return emailv1.EmailPhaseExpired, "", err
+		}
+		if err := r.recordSendIntent(ctx, email, b, key); err != nil {
+			return emailv1.EmailPhaseRetrying, "", fmt.Errorf("failed to record send attempt: %w", err)
+		}
+		countAttempt()
 
-	res, err := ms.Email.Send(ctx, message)
-	if err != nil {
-		log.Error(err, "Failed to send email with MailerSend")
-		return "Failed", "", err
+		msg.IdempotencyKey = key
+		messageID, recipients, err := send(ctx, provider, msg)
+		if !mayHaveBeenSent(err) {
+			email.Status.AttemptID = ""
+		}
+		recordAttempt(email, b, err)
+		r.recordRecipients(email, recipients)
+		if countErr := r.countSend(ctx, client.ObjectKeyFromObject(config), b.name, err); countErr != nil {
+			log.Error(countErr, "Failed to update backend send counts", "backend", b.name)
+		}
+		if err == nil {
+			email.Status.Backend = b.name
+			return emailv1.EmailPhaseSent, messageID, nil
+		}
+		if mayHaveBeenSent(err) {
+			// Failing over could deliver the email twice, so check with this
+			// backend on the next try instead.
+			log.Error(err, "Backend may have accepted the email, retrying it rather than failing over", "backend", b.name)
+			return emailv1.EmailPhaseRetrying, "", err
+		}
+		if !policy.retryable(err) {
+			return emailv1.EmailPhaseFailed, "", err
+		}
+		log.Error(err, "Backend failed with a retryable error, trying the next one", "backend", b.name)
+		lastErr, retryErr = err, err
 	}
 
-	messageID := res.Header.Get("X-Message-Id")
-	log.Info("Email sent successfully", "messageID", messageID)
-	return "Sent", messageID, nil
+	// Retry later if any backend might succeed then.
+	if retryErr != nil {
+		return emailv1.EmailPhaseRetrying, "", retryErr
+	}
+	return emailv1.EmailPhaseFailed, "", lastErr
 }
 
-func getSecretValues(namespace, secretName string) (string, string, error) {
-	config, err := rest.InClusterConfig()
+// dryRun records the fully rendered message in status and an Event instead
+// of sending it, and shows it through providers that never send. The
+// Message-ID and Date come from the Email itself, so rendering an unchanged
+// Email again gives the same message.
+func (r *EmailReconciler) dryRun(ctx context.Context, email *emailv1.Email, provider Provider, msg *Message) (emailv1.EmailPhase, string, error) {
+	msg.IdempotencyKey = string(email.UID)
+	messageID, raw, err := renderMessage(msg, email.CreationTimestamp.Time)
 	if err != nil {
-		return "", "", err
+		return emailv1.EmailPhaseFailed, "", err
 	}
+	email.Status.RenderedMessage = truncateRendered(raw)
+	email.Status.Provider = provider.Name()
+	if p, ok := provider.(dryRunProvider); ok {
+		p.showRendered(ctx, messageID, msg, raw)
+	}
+	r.event(email, corev1.EventTypeNormal, "DryRun", fmt.Sprintf(
+		"Rendered %d byte message %s for %s via %s without sending", len(raw), messageID, joinAddresses(msg.Recipients()), provider.Name()))
+	return emailv1.EmailPhaseDryRun, messageID, nil
+}
 
-	k8sClient, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return "", "", err
+// recordRecipients stores the provider's per-recipient results in status and
+// emits a Warning Event for each rejected recipient.
+func (r *EmailReconciler) recordRecipients(email *emailv1.Email, results []RecipientResult) {
+	if results == nil {
+		return
+	}
+	email.Status.Recipients = make([]emailv1.RecipientStatus, 0, len(results))
+	for _, res := range results {
+		status := emailv1.RecipientStatus{Email: res.Email, Accepted: res.Err == nil}
+		if res.Err != nil {
+			status.Error = res.Err.Error()
+			r.event(email, corev1.EventTypeWarning, "RecipientRejected", fmt.Sprintf("%s: %v", res.Email, res.Err))
+		}
+		email.Status.Recipients = append(email.Status.Recipients, status)
 	}
+}
 
-	secret, err := k8sClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
-	if err != nil {
-		return "", "", err
+// event records an Event on the Email when a recorder is configured.
+func (r *EmailReconciler) event(email *emailv1.Email, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(email, eventType, reason, message)
 	}
+}
 
-	apiToken := string(secret.Data["api-token"])
-	fromEmail := string(secret.Data["from-email"])
+func (r *EmailReconciler) providers() *ProviderRegistry {
+	if r.Providers != nil {
+		return r.Providers
+	}
+	return DefaultProviders
+}
 
-	log := log.Log
-	log.Info("Fetched API Token", "apiToken", apiToken)
-	log.Info("Fetched From Email", "fromEmail", fromEmail)
+func (r *EmailReconciler) getSecretValues(ctx context.Context, namespace, secretName string) (map[string][]byte, error) {
+	var secret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Name: secretName, Namespace: namespace}, &secret); err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
 
-	return apiToken, fromEmail, nil
+// emailsForConfig returns the Emails waiting on the sender config, so that
+// they are sent once it becomes Ready.
+func (r *EmailReconciler) emailsForConfig(obj client.Object) []reconcile.Request {
+	var emails emailv1.EmailList
+	if err := r.List(context.Background(), &emails, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, email := range emails.Items {
+		if email.Spec.SenderConfigRef != obj.GetName() {
+			continue
+		}
+		if email.Status.DeliveryStatus == "" || email.Status.DeliveryStatus == emailv1.EmailPhasePending {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&email)})
+		}
+	}
+	return requests
 }
 
 func (r *EmailReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&emailv1.Email{}).
+		Watches(&source.Kind{Type: &emailv1.EmailSenderConfig{}}, handler.EnqueueRequestsFromMapFunc(r.emailsForConfig)).
 		Complete(r)
 }
@@ -2,24 +2,75 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
-	"k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
 )
 
+const (
+	// verifyInterval is how often the credentials of a Ready sender config
+	// are checked again, to notice revoked tokens.
+	verifyInterval = time.Hour
+	// notReadyInterval is how often a sender config that is not Ready is
+	// checked again, to notice domains verified with the provider since.
+	notReadyInterval = 5 * time.Minute
+)
+
+// Reasons of an EmailSenderConfig's Ready condition.
+const (
+	reasonVerified             = "Verified"
+	reasonSecretNotFound       = "SecretNotFound"
+	reasonInvalidConfiguration = "InvalidConfiguration"
+	reasonInvalidCredentials   = "InvalidCredentials"
+	reasonDomainNotVerified    = "DomainNotVerified"
+	reasonVerificationFailed   = "VerificationFailed"
+)
+
+// configError is why a sender config is not Ready.
+type configError struct {
+	reason string
+	err    error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
 // EmailSenderConfigReconciler reconciles an EmailSenderConfig object
 type EmailSenderConfigReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Providers resolves provider names to implementations. DefaultProviders
+	// is used when nil.
+	Providers *ProviderRegistry
 }
 
 //+kubebuilder:rbac:groups=email.mailerlitetask.com,resources=emailsenderconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=email.mailerlitetask.com,resources=emailsenderconfigs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -31,7 +82,7 @@ func (r *EmailSenderConfigReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	// Fetch the EmailSenderConfig instance
 	var emailSenderConfig emailv1.EmailSenderConfig
 	if err := r.Get(ctx, req.NamespacedName, &emailSenderConfig); err != nil {
-		if errors.IsNotFound(err) {
+		if apierrors.IsNotFound(err) {
 			// EmailSenderConfig resource not found. Ignoring since object must be deleted.
 			log.Info("EmailSenderConfig resource not found. Ignoring since object must be deleted.")
 			return ctrl.Result{}, nil
@@ -43,7 +94,40 @@ func (r *EmailSenderConfigReconciler) Reconcile(ctx context.Context, req ctrl.Re
 
 	log.Info("EmailSenderConfig resource found", "emailsenderconfig", emailSenderConfig)
 
-	emailSenderConfig.Status.Error = ""
+	// Check the Secret and the credentials in it with each backend's provider
+	err := r.verify(ctx, &emailSenderConfig)
+	var cfgErr *configError
+	status := &emailSenderConfig.Status
+	generation := emailSenderConfig.Generation
+	requeueAfter := verifyInterval
+	switch {
+	case err == nil:
+		status.Error = ""
+		setCondition(&status.Conditions, generation, emailv1.ConditionReady, true, reasonVerified, "Credentials verified for every backend")
+	case !errors.As(err, &cfgErr):
+		// The provider could not be asked. A config verified for this
+		// generation stays Ready rather than holding up every Email.
+		log.Error(err, "Failed to verify EmailSenderConfig, trying again later")
+		requeueAfter = time.Minute
+		ready := meta.FindStatusCondition(status.Conditions, emailv1.ConditionReady)
+		if ready != nil && ready.Status == metav1.ConditionTrue && ready.ObservedGeneration == generation {
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		status.Error = err.Error()
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               emailv1.ConditionReady,
+			Status:             metav1.ConditionUnknown,
+			ObservedGeneration: generation,
+			Reason:             reasonVerificationFailed,
+			Message:            err.Error(),
+		})
+	default:
+		log.Info("EmailSenderConfig is not ready", "reason", cfgErr.reason, "error", err.Error())
+		requeueAfter = notReadyInterval
+		status.Error = err.Error()
+		setCondition(&status.Conditions, generation, emailv1.ConditionReady, false, cfgErr.reason, err.Error())
+	}
+	status.ObservedGeneration = generation
 
 	// Update the status of the EmailSenderConfig resource
 	if err := r.Status().Update(ctx, &emailSenderConfig); err != nil {
@@ -52,12 +136,130 @@ func (r *EmailSenderConfigReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	}
 
 	log.Info("EmailSenderConfig status updated successfully")
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// verify resolves the Secret of every backend, checks it has the keys the
+// backend's provider needs and, for providers that can, checks the
+// credentials and sending domain with the provider. Failures that will not go
+// away without a change to the config, its Secret or the provider account
+// are returned as *configError; anything else may pass on its own.
+func (r *EmailSenderConfigReconciler) verify(ctx context.Context, config *emailv1.EmailSenderConfig) error {
+	secrets := map[string]map[string][]byte{}
+	getSecret := func(name string) (map[string][]byte, error) {
+		if data, ok := secrets[name]; ok {
+			return data, nil
+		}
+		var secret corev1.Secret
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: config.Namespace}, &secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, &configError{reason: reasonSecretNotFound, err: fmt.Errorf("secret %s not found", name)}
+			}
+			return nil, fmt.Errorf("failed to get secret %s: %w", name, err)
+		}
+		secrets[name] = secret.Data
+		return secret.Data, nil
+	}
+
+	secret, err := getSecret(config.Spec.ApiTokenSecretRef)
+	if err != nil {
+		return err
+	}
+	from := config.Spec.SenderEmail
+	if from == "" {
+		from = string(secret["from-email"])
+	}
+	if from == "" && len(config.Spec.AllowedSenders) == 0 {
+		return &configError{reason: reasonInvalidConfiguration, err: fmt.Errorf(
+			"neither spec.senderEmail nor key from-email of secret %s is set", config.Spec.ApiTokenSecretRef)}
+	}
+	var domain string
+	if from != "" {
+		if err := validSenderAddress(from); err != nil {
+			return &configError{reason: reasonInvalidConfiguration, err: fmt.Errorf("invalid sender %q: %w", from, err)}
+		}
+		domain = from[strings.LastIndex(from, "@")+1:]
+	}
+
+	for _, b := range backendChain(config) {
+		backendSecret, err := getSecret(b.secretRef)
+		if err != nil {
+			return backendError(b, err)
+		}
+		provider, err := r.providers().New(providerName(b.settings), ProviderConfig{
+			Spec:   b.spec(config.Spec),
+			Secret: backendSecret,
+		})
+		if err != nil {
+			return backendError(b, &configError{reason: reasonInvalidConfiguration, err: err})
+		}
+		v, ok := provider.(verifier)
+		if !ok {
+			continue
+		}
+		if err := v.Verify(ctx, domain); err != nil {
+			return backendError(b, verifyError(err))
+		}
+	}
+	return nil
+}
+
+// backendError names the backend an error is about, keeping its reason.
+func backendError(b senderBackend, err error) error {
+	var cfgErr *configError
+	if errors.As(err, &cfgErr) {
+		return &configError{reason: cfgErr.reason, err: fmt.Errorf("backend %s: %w", b.name, cfgErr.err)}
+	}
+	return fmt.Errorf("backend %s: %w", b.name, err)
+}
+
+// verifyError classifies an error from a verifier: rejected credentials and
+// unverified domains are configuration problems, anything else may pass.
+func verifyError(err error) error {
+	if errors.Is(err, errDomainNotVerified) {
+		return &configError{reason: reasonDomainNotVerified, err: err}
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+		return &configError{reason: reasonInvalidCredentials, err: err}
+	}
+	if isRetryable(err) {
+		return err
+	}
+	return &configError{reason: reasonVerificationFailed, err: err}
+}
+
+func (r *EmailSenderConfigReconciler) providers() *ProviderRegistry {
+	if r.Providers != nil {
+		return r.Providers
+	}
+	return DefaultProviders
+}
+
+// configsForSecret returns the sender configs in the Secret's namespace that
+// use it, so that they are verified again when it changes.
+func (r *EmailSenderConfigReconciler) configsForSecret(obj client.Object) []reconcile.Request {
+	var configs emailv1.EmailSenderConfigList
+	if err := r.List(context.Background(), &configs, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, config := range configs.Items {
+		for _, b := range backendChain(&config) {
+			if b.secretRef == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&config)})
+				break
+			}
+		}
+	}
+	return requests
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. Status updates
+// are ignored so that counting sends does not verify the config again.
 func (r *EmailSenderConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&emailv1.EmailSenderConfig{}).
+		For(&emailv1.EmailSenderConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.configsForSecret)).
 		Complete(r)
 }
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// verifyingProvider is a fakeProvider that checks its credentials with
+// verify.
+type verifyingProvider struct {
+	*fakeProvider
+	domain string
+	verify error
+}
+
+func (p *verifyingProvider) Verify(ctx context.Context, domain string) error {
+	p.domain = domain
+	return p.verify
+}
+
+var _ = Describe("EmailSenderConfigReconciler", func() {
+	var (
+		ctx      context.Context
+		provider *verifyingProvider
+		r        *EmailSenderConfigReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		provider = &verifyingProvider{fakeProvider: &fakeProvider{}}
+		registry := NewProviderRegistry()
+		registry.Register("Fake", func(config ProviderConfig) (Provider, error) {
+			provider.config = config
+			return provider, nil
+		})
+
+		s := newTestScheme()
+		r = &EmailSenderConfigReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).WithObjects(
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+					Data: map[string][]byte{
+						"api-token":  []byte("secret"),
+						"from-email": []byte("sender@example.com"),
+					},
+				},
+				&emailv1.EmailSenderConfig{
+					ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+					Spec: emailv1.EmailSenderConfigSpec{
+						ApiTokenSecretRef: "token",
+						ProviderSettings:  emailv1.ProviderSettings{Provider: "Fake"},
+					},
+				},
+			).Build(),
+			Scheme:    s,
+			Providers: registry,
+		}
+	})
+
+	reconcileConfig := func() (*emailv1.EmailSenderConfig, ctrl.Result) {
+		key := client.ObjectKey{Name: "config", Namespace: "default"}
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		var config emailv1.EmailSenderConfig
+		Expect(r.Get(ctx, key, &config)).To(Succeed())
+		return &config, result
+	}
+
+	readyCondition := func(config *emailv1.EmailSenderConfig) *metav1.Condition {
+		ready := meta.FindStatusCondition(config.Status.Conditions, emailv1.ConditionReady)
+		Expect(ready).NotTo(BeNil())
+		return ready
+	}
+
+	It("is Ready once the provider accepts the credentials", func() {
+		config, result := reconcileConfig()
+		Expect(readyCondition(config).Status).To(Equal(metav1.ConditionTrue))
+		Expect(readyCondition(config).Reason).To(Equal("Verified"))
+		Expect(config.Status.Error).To(BeEmpty())
+		Expect(provider.domain).To(Equal("example.com"))
+		Expect(result.RequeueAfter).To(Equal(verifyInterval))
+	})
+
+	It("is not Ready without its Secret", func() {
+		Expect(r.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"}})).To(Succeed())
+		config, _ := reconcileConfig()
+		Expect(readyCondition(config).Status).To(Equal(metav1.ConditionFalse))
+		Expect(readyCondition(config).Reason).To(Equal("SecretNotFound"))
+		Expect(config.Status.Error).To(Equal("secret token not found"))
+	})
+
+	It("is not Ready when the Secret lacks a key the provider needs", func() {
+		Expect(r.Update(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+			Data:       map[string][]byte{"from-email": []byte("sender@example.com")},
+		})).To(Succeed())
+		config, _ := reconcileConfig()
+		Expect(readyCondition(config).Reason).To(Equal("InvalidConfiguration"))
+		Expect(readyCondition(config).Message).To(Equal("backend default: invalid Fake provider configuration: secret key api-token is empty"))
+	})
+
+	It("reports rejected credentials and unverified domains", func() {
+		provider.verify = &httpStatusError{Provider: "Fake", StatusCode: 401, Body: "Unauthenticated."}
+		config, result := reconcileConfig()
+		Expect(readyCondition(config).Status).To(Equal(metav1.ConditionFalse))
+		Expect(readyCondition(config).Reason).To(Equal("InvalidCredentials"))
+		Expect(result.RequeueAfter).To(Equal(notReadyInterval))
+
+		provider.verify = fmt.Errorf("example.com is not a domain of the account: %w", errDomainNotVerified)
+		config, _ = reconcileConfig()
+		Expect(readyCondition(config).Reason).To(Equal("DomainNotVerified"))
+		Expect(readyCondition(config).Message).To(Equal("backend default: example.com is not a domain of the account: domain is not verified"))
+	})
+
+	It("stays Ready when the provider cannot be asked", func() {
+		config, _ := reconcileConfig()
+		Expect(readyCondition(config).Status).To(Equal(metav1.ConditionTrue))
+
+		provider.verify = &httpStatusError{Provider: "Fake", StatusCode: 503, Body: "unavailable"}
+		config, result := reconcileConfig()
+		Expect(readyCondition(config).Status).To(Equal(metav1.ConditionTrue))
+		Expect(result.RequeueAfter).To(Equal(time.Minute))
+
+		// A config never verified is Unknown until the provider answers.
+		config.Status.Conditions = nil
+		Expect(r.Status().Update(ctx, config)).To(Succeed())
+		config, _ = reconcileConfig()
+		Expect(readyCondition(config).Status).To(Equal(metav1.ConditionUnknown))
+		Expect(readyCondition(config).Reason).To(Equal("VerificationFailed"))
+	})
+
+	It("verifies every backend with its own Secret", func() {
+		key := client.ObjectKey{Name: "config", Namespace: "default"}
+		var config emailv1.EmailSenderConfig
+		Expect(r.Get(ctx, key, &config)).To(Succeed())
+		config.Spec.Backends = []emailv1.ProviderBackend{
+			{Name: "primary", ProviderSettings: emailv1.ProviderSettings{Provider: "Fake"}},
+			{Name: "secondary", SecretRef: "other", ProviderSettings: emailv1.ProviderSettings{Provider: "Fake"}},
+		}
+		Expect(r.Update(ctx, &config)).To(Succeed())
+
+		updated, _ := reconcileConfig()
+		Expect(readyCondition(updated).Message).To(Equal("backend secondary: secret other not found"))
+		Expect(r.configsForSecret(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}})).To(HaveLen(1))
+		Expect(r.configsForSecret(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unused", Namespace: "default"}})).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Provider verification", func() {
+	It("checks MailerSend tokens and that the sending domain is verified", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/v1/domains"))
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"message":"Unauthenticated."}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Query().Get("page") == "2" {
+				_, _ = w.Write([]byte(`{"data":[{"name":"later.example.com","is_verified":true}],"links":{"next":null}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":[{"name":"example.com","is_verified":true},{"name":"new.example.com","is_verified":false}],` +
+				`"links":{"next":"https://api.mailersend.com/v1/domains?page=2"}}`))
+		}))
+		defer server.Close()
+		target, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		client := &http.Client{Transport: redirectTransport{target: target}}
+
+		p := &mailerSendProvider{apiToken: "token", client: client}
+		Expect(p.Verify(context.Background(), "example.com")).To(Succeed())
+		Expect(p.Verify(context.Background(), "new.example.com")).To(MatchError(errDomainNotVerified))
+		Expect(p.Verify(context.Background(), "later.example.com")).To(Succeed())
+		Expect(p.Verify(context.Background(), "other.com")).To(MatchError("other.com is not a domain of the mailersend account: domain is not verified"))
+
+		p = &mailerSendProvider{apiToken: "wrong", client: client}
+		err = p.Verify(context.Background(), "example.com")
+		var statusErr *httpStatusError
+		Expect(errors.As(err, &statusErr)).To(BeTrue())
+		Expect(statusErr.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("checks that the Mailgun domain is active", func() {
+		state := "unverified"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v3/domains/mg.example.com" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"domain":{"name":"mg.example.com","state":"` + state + `"}}`))
+		}))
+		defer server.Close()
+
+		p := &mailgunProvider{apiKey: "key", domain: "mg.example.com", baseURL: server.URL + "/v3", client: server.Client()}
+		Expect(p.Verify(context.Background(), "")).To(MatchError("mailgun domain mg.example.com is unverified: domain is not verified"))
+		state = "active"
+		Expect(p.Verify(context.Background(), "")).To(Succeed())
+		p.domain = "other.example.com"
+		Expect(p.Verify(context.Background(), "")).To(MatchError(errDomainNotVerified))
+	})
+
+	It("checks that SendGrid API keys may send mail", func() {
+		scopes := `["mail.send"]`
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/scopes"))
+			_, _ = w.Write([]byte(`{"scopes":` + scopes + `}`))
+		}))
+		defer server.Close()
+
+		p := &sendGridProvider{apiKey: "key", baseURL: server.URL, client: server.Client()}
+		Expect(p.Verify(context.Background(), "example.com")).To(Succeed())
+		scopes = `["stats.read"]`
+		Expect(p.Verify(context.Background(), "example.com")).To(MatchError("SendGrid returned 403 Forbidden: API key lacks the mail.send scope"))
+	})
+})
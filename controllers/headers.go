@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// deniedHeaders are set by the operator or the provider and cannot be
+// overridden through spec.headers. Content-* headers are denied as well.
+var deniedHeaders = map[string]bool{
+	"Bcc":                     true,
+	"Cc":                      true,
+	"Date":                    true,
+	"Dkim-Signature":          true,
+	"From":                    true,
+	"In-Reply-To":             true,
+	"Message-Id":              true,
+	"Mime-Version":            true,
+	"Received":                true,
+	"References":              true,
+	"Reply-To":                true,
+	"Return-Path":             true,
+	"Sender":                  true,
+	"Subject":                 true,
+	"To":                      true,
+	"X-Mailgun-Variables":     true,
+	"X-Pm-Message-Stream":     true,
+	"X-Ses-Configuration-Set": true,
+	"X-Smtpapi":               true,
+}
+
+// messageHeaders validates an Email's extra headers and returns them with
+// canonical names.
+func messageHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("spec.headers: invalid header name %q", name)
+		}
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		if deniedHeaders[canonical] || strings.HasPrefix(canonical, "Content-") {
+			return nil, fmt.Errorf("spec.headers: header %s cannot be overridden", canonical)
+		}
+		// A line break would let the value inject further headers.
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("spec.headers: header %s contains a line break", canonical)
+		}
+		if _, ok := out[canonical]; ok {
+			return nil, fmt.Errorf("spec.headers: header %s is set more than once", canonical)
+		}
+		out[canonical] = value
+	}
+	return out, nil
+}
+
+// validHeaderName reports whether name is an RFC 5322 field name: printable
+// ASCII without spaces or colons.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c > '~' || c == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedHeaderNames returns the names of headers in a stable order.
+func sortedHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// redirectTransport sends every request to target, for SDKs with a fixed base URL.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// headerMessage is contractMessage with a Reply-To and an extra header.
+func headerMessage() *Message {
+	msg := contractMessage()
+	msg.ReplyTo = &Address{Name: "Support", Email: "support@example.com"}
+	msg.Headers = map[string]string{"X-Campaign": "spring"}
+	return msg
+}
+
+var _ = Describe("Headers, Reply-To and sender names", func() {
+	It("canonicalizes headers and denies the ones the operator sets", func() {
+		headers, err := messageHeaders(map[string]string{"x-campaign": "spring"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(Equal(map[string]string{"X-Campaign": "spring"}))
+
+		for name, want := range map[string]string{
+			"from":         "header From cannot be overridden",
+			"Content-Type": "header Content-Type cannot be overridden",
+			"reply-to":     "header Reply-To cannot be overridden",
+			"X-Bad Name":   "invalid header name",
+			"X-Injected":   "contains a line break",
+		} {
+			value := "x"
+			if name == "X-Injected" {
+				value = "x\r\nBcc: victim@example.com"
+			}
+			_, err := messageHeaders(map[string]string{name: value})
+			Expect(err).To(MatchError(ContainSubstring(want)), name)
+		}
+	})
+
+	It("lets the Email override the sender config's name and Reply-To", func() {
+		config := emailv1.EmailSenderConfigSpec{
+			FromName: "Acme",
+			ReplyTo:  &emailv1.EmailAddress{Email: "noreply@example.com"},
+		}
+		email := &emailv1.Email{Spec: emailv1.EmailSpec{RecipientEmail: "recipient@example.com"}}
+		msg, err := newMessage(email, "sender@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applySenderDefaults(msg, config)).To(Succeed())
+		Expect(msg.From).To(Equal(Address{Name: "Acme", Email: "sender@example.com"}))
+		Expect(msg.ReplyTo).To(Equal(&Address{Email: "noreply@example.com"}))
+
+		email.Spec.FromName = "Acme Billing"
+		email.Spec.ReplyTo = &emailv1.EmailAddress{Name: "Billing", Email: "billing@example.com"}
+		msg, err = newMessage(email, "sender@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applySenderDefaults(msg, config)).To(Succeed())
+		Expect(msg.From.Name).To(Equal("Acme Billing"))
+		Expect(msg.ReplyTo).To(Equal(&Address{Name: "Billing", Email: "billing@example.com"}))
+	})
+
+	It("writes Reply-To and extra headers into MIME messages", func() {
+		raw, err := buildMIME(headerMessage(), "<id@example.com>", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Header.Get("Reply-To")).To(Equal(`"Support" <support@example.com>`))
+		Expect(parsed.Header.Get("X-Campaign")).To(Equal("spring"))
+		Expect(parsed.Header.Get("To")).To(Equal(`"Recipient" <recipient@example.com>`))
+
+		msg := headerMessage()
+		msg.Bcc, msg.To = msg.To, nil
+		raw, err = buildMIME(msg, "<id@example.com>", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(raw)).To(ContainSubstring("\r\nTo: undisclosed-recipients:;\r\n"))
+		Expect(string(raw)).NotTo(ContainSubstring("recipient@example.com"))
+	})
+
+	It("maps them onto MailerSend", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			var body struct {
+				From    map[string]string   `json:"from"`
+				ReplyTo map[string]string   `json:"reply_to"`
+				Headers []map[string]string `json:"headers"`
+				Subject string              `json:"subject"`
+			}
+			decodeJSON(r, &body)
+			Expect(body.From).To(Equal(map[string]string{"name": "Operator", "email": "sender@example.com"}))
+			Expect(body.ReplyTo).To(Equal(map[string]string{"name": "Support", "email": "support@example.com"}))
+			Expect(body.Headers).To(Equal([]map[string]string{{"name": "X-Campaign", "value": "spring"}}))
+			Expect(body.Subject).To(Equal("Hello"))
+			w.Header().Set("X-Message-Id", "ms-1")
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		target, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		p := &mailerSendProvider{apiToken: "token", client: &http.Client{Transport: redirectTransport{target: target}}}
+		messageID, err := p.Send(context.Background(), headerMessage())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messageID).To(Equal("ms-1"))
+	})
+
+	It("maps them onto SendGrid, Mailgun, Postmark and SES", func() {
+		var sendGrid sendGridMessage
+		var postmark postmarkMessage
+		var ses sesSendEmailRequest
+		var mailgun url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			switch {
+			case r.URL.Path == "/mail/send":
+				decodeJSON(r, &sendGrid)
+				w.WriteHeader(http.StatusAccepted)
+			case r.URL.Path == "/email":
+				decodeJSON(r, &postmark)
+				_, _ = w.Write([]byte(`{"MessageID":"pm-1","ErrorCode":0}`))
+			case strings.HasPrefix(r.URL.Path, "/v2/"):
+				decodeJSON(r, &ses)
+				_, _ = w.Write([]byte(`{"MessageId":"ses-1"}`))
+			default:
+				Expect(r.ParseForm()).To(Succeed())
+				mailgun = r.PostForm
+				_, _ = w.Write([]byte(`{"id":"<1@mg.example.com>"}`))
+			}
+		}))
+		defer server.Close()
+
+		ctx := context.Background()
+		for _, p := range []Provider{
+			&sendGridProvider{apiKey: "key", baseURL: server.URL, client: server.Client()},
+			&mailgunProvider{apiKey: "key", domain: "mg.example.com", baseURL: server.URL, client: server.Client()},
+			&postmarkProvider{serverToken: "token", baseURL: server.URL, client: server.Client()},
+			&sesProvider{region: "eu-west-1", endpoint: server.URL, client: server.Client()},
+		} {
+			_, err := p.Send(ctx, headerMessage())
+			Expect(err).NotTo(HaveOccurred(), p.Name())
+		}
+
+		Expect(sendGrid.ReplyTo).To(Equal(&sendGridAddress{Email: "support@example.com", Name: "Support"}))
+		Expect(sendGrid.Headers).To(Equal(map[string]string{"X-Campaign": "spring"}))
+		Expect(mailgun.Get("h:Reply-To")).To(Equal(`"Support" <support@example.com>`))
+		Expect(mailgun.Get("h:X-Campaign")).To(Equal("spring"))
+		Expect(postmark.ReplyTo).To(Equal(`"Support" <support@example.com>`))
+		Expect(postmark.Headers).To(Equal([]postmarkHeader{{Name: "X-Campaign", Value: "spring"}}))
+		Expect(ses.ReplyToAddresses).To(Equal([]string{`"Support" <support@example.com>`}))
+		Expect(ses.Content.Simple.Headers).To(Equal([]sesHeader{{Name: "X-Campaign", Value: "spring"}}))
+	})
+})
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlToText renders an HTML body as readable plain text for the text/plain
+// alternative of a message. Tags are stripped, block elements start new
+// lines, list items are bulleted and links keep their target in brackets.
+func htmlToText(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	w := &textWriter{}
+	w.walk(doc)
+	return w.String(), nil
+}
+
+// textWriter accumulates text while collapsing whitespace the way a browser
+// would, except inside <pre>.
+type textWriter struct {
+	b strings.Builder
+	// newlines is the number of newlines owed before the next text.
+	newlines int
+	// space is set when whitespace was seen since the last text.
+	space bool
+	pre   int
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.walk(c)
+		}
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Template:
+		return
+	case atom.Br:
+		w.lineBreak(1)
+		return
+	case atom.Hr:
+		w.lineBreak(2)
+		w.text("----")
+		w.lineBreak(2)
+		return
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			w.text(alt)
+		}
+		return
+	}
+
+	block := blockElements[n.DataAtom]
+	if block > 0 {
+		w.lineBreak(block)
+	}
+	switch n.DataAtom {
+	case atom.Li:
+		w.text("- ")
+	case atom.Td, atom.Th:
+		if n.PrevSibling != nil {
+			w.text(" ")
+		}
+	case atom.Pre:
+		w.pre++
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+
+	switch n.DataAtom {
+	case atom.A:
+		if href := attr(n, "href"); linkWorthKeeping(href, textContent(n)) {
+			w.text(" (" + href + ")")
+		}
+	case atom.Pre:
+		w.pre--
+	}
+	if block > 0 {
+		w.lineBreak(block)
+	}
+}
+
+// blockElements maps block elements to the line breaks around them: 1 for a
+// new line, 2 for a blank line.
+var blockElements = map[atom.Atom]int{
+	atom.Address: 2, atom.Article: 2, atom.Aside: 2, atom.Blockquote: 2,
+	atom.Div: 1, atom.Dl: 2, atom.Dt: 1, atom.Dd: 1, atom.Fieldset: 2,
+	atom.Figure: 2, atom.Footer: 2, atom.Form: 2, atom.H1: 2, atom.H2: 2,
+	atom.H3: 2, atom.H4: 2, atom.H5: 2, atom.H6: 2, atom.Header: 2,
+	atom.Li: 1, atom.Main: 2, atom.Nav: 2, atom.Ol: 2, atom.P: 2,
+	atom.Pre: 2, atom.Section: 2, atom.Table: 2, atom.Tr: 1, atom.Ul: 2,
+}
+
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		w.flush()
+		w.b.WriteString(s)
+		return
+	}
+	for s != "" {
+		i := strings.IndexFunc(s, isHTMLSpace)
+		if i == 0 {
+			w.space = true
+			s = strings.TrimLeftFunc(s, isHTMLSpace)
+			continue
+		}
+		if i < 0 {
+			i = len(s)
+		}
+		w.flush()
+		w.b.WriteString(s[:i])
+		s = s[i:]
+	}
+}
+
+// flush writes any pending line breaks or space before new text.
+func (w *textWriter) flush() {
+	if w.b.Len() == 0 {
+		w.newlines, w.space = 0, false
+		return
+	}
+	if w.newlines > 0 {
+		w.b.WriteString(strings.Repeat("\n", w.newlines))
+	} else if w.space {
+		w.b.WriteByte(' ')
+	}
+	w.newlines, w.space = 0, false
+}
+
+func (w *textWriter) lineBreak(n int) {
+	if n > w.newlines {
+		w.newlines = n
+	}
+}
+
+func (w *textWriter) String() string {
+	return strings.TrimSpace(w.b.String())
+}
+
+// isHTMLSpace reports whether r is whitespace that HTML collapses. Unlike
+// unicode.IsSpace it leaves non-breaking spaces alone.
+func isHTMLSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\f':
+		return true
+	}
+	return false
+}
+
+// linkWorthKeeping reports whether a link's target adds anything to its text.
+func linkWorthKeeping(href, text string) bool {
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return false
+	}
+	text = strings.TrimSpace(text)
+	return text != href && "mailto:"+text != href
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("htmlToText", func() {
+	convert := func(in string) string {
+		out, err := htmlToText(in)
+		Expect(err).NotTo(HaveOccurred())
+		return out
+	}
+
+	It("strips tags and drops head, script and style content", func() {
+		Expect(convert(`<html><head><title>T</title><style>p{color:red}</style></head>` +
+			`<body><script>alert(1)</script><p>Hello <b>Ada</b>,</p><p>Welcome   aboard.</p></body></html>`)).
+			To(Equal("Hello Ada,\n\nWelcome aboard."))
+	})
+
+	It("keeps link targets that differ from the link text", func() {
+		Expect(convert(`<p><a href="https://example.com/reset">Reset your password</a> or ` +
+			`visit <a href="https://example.com">https://example.com</a>, ` +
+			`<a href="mailto:help@example.com">help@example.com</a>.</p>`)).
+			To(Equal("Reset your password (https://example.com/reset) or visit https://example.com, help@example.com."))
+	})
+
+	It("breaks lines for blocks, line breaks, lists and tables", func() {
+		Expect(convert(`<h1>Report</h1>Line one<br>Line two<ul><li>First</li><li>Second</li></ul>` +
+			`<table><tr><th>Name</th><th>Value</th></tr><tr><td>a</td><td>1</td></tr></table>`)).
+			To(Equal("Report\n\nLine one\nLine two\n\n- First\n- Second\n\nName Value\na 1"))
+	})
+
+	It("preserves preformatted text and decodes entities", func() {
+		Expect(convert("<pre>  indented\n  code</pre><p>&copy; 2024 &amp; co</p>")).
+			To(Equal("indented\n  code\n\n© 2024 & co"))
+	})
+})
+
+var _ = Describe("newMessage bodies", func() {
+	email := func(spec func(*emailv1.EmailSpec)) *Message {
+		e := &emailv1.Email{Spec: emailv1.EmailSpec{RecipientEmail: "recipient@example.com"}}
+		spec(&e.Spec)
+		msg, err := newMessage(e, "sender@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		return msg
+	}
+
+	It("generates a text alternative for HTML-only emails", func() {
+		msg := email(func(s *emailv1.EmailSpec) { s.HTMLBody = "<p>Hi <a href=\"https://example.com\">there</a></p>" })
+		Expect(msg.HTML).To(Equal("<p>Hi <a href=\"https://example.com\">there</a></p>"))
+		Expect(msg.Text).To(Equal("Hi there (https://example.com)"))
+	})
+
+	It("uses both bodies as given", func() {
+		msg := email(func(s *emailv1.EmailSpec) { s.HTMLBody, s.TextBody = "<p>Hi</p>", "Hello" })
+		Expect(msg.HTML).To(Equal("<p>Hi</p>"))
+		Expect(msg.Text).To(Equal("Hello"))
+	})
+
+	It("treats the legacy body as plain text", func() {
+		msg := email(func(s *emailv1.EmailSpec) { s.Body = "Plain <not a tag>" })
+		Expect(msg.HTML).To(BeEmpty())
+		Expect(msg.Text).To(Equal("Plain <not a tag>"))
+	})
+})
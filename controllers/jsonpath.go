@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// evalJSONPath evaluates expr against data and returns the result as a
+// string. expr may be a kubectl style template ({.items[0].id}), a $-rooted
+// JSONPath ($.items[0].id) or a gjson style dotted path (items.0.id).
+func evalJSONPath(data interface{}, expr string) (string, error) {
+	jp := jsonpath.New("path").AllowMissingKeys(false)
+	if err := jp.Parse(normalizeJSONPath(expr)); err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", expr, err)
+	}
+	var buf bytes.Buffer
+	if err := jp.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("path %q: %w", expr, err)
+	}
+	return buf.String(), nil
+}
+
+// evalJSONPathBytes decodes a JSON document and evaluates expr against it.
+func evalJSONPathBytes(body []byte, expr string) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return "", fmt.Errorf("response is not JSON: %w", err)
+	}
+	return evalJSONPath(data, expr)
+}
+
+func normalizeJSONPath(expr string) string {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case strings.HasPrefix(expr, "{"):
+		return expr
+	case strings.HasPrefix(expr, "$"):
+		return "{" + expr[1:] + "}"
+	}
+
+	var b strings.Builder
+	b.WriteString("{")
+	for _, segment := range strings.Split(strings.TrimPrefix(expr, "."), ".") {
+		if isDigits(segment) {
+			b.WriteString("[" + segment + "]")
+		} else {
+			b.WriteString("." + segment)
+		}
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
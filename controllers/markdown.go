@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// markdown converts Markdown bodies to HTML. Without the unsafe option
+// goldmark drops raw HTML and links with dangerous schemes such as
+// javascript:, so the output is safe to send whoever wrote the Markdown.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// layoutData is what a layout template is rendered with.
+type layoutData struct {
+	Subject string
+	Content htmltemplate.HTML
+}
+
+// renderBodyFormat returns a copy of email with a Markdown or HTML body moved
+// into its HTML and text bodies. Plain-text bodies are returned unchanged.
+func (r *EmailReconciler) renderBodyFormat(ctx context.Context, email *emailv1.Email, config *emailv1.EmailSenderConfig) (*emailv1.Email, error) {
+	spec := email.Spec
+	if spec.BodyFormat == "" || spec.BodyFormat == emailv1.BodyFormatText {
+		return email, nil
+	}
+	if spec.HTMLBody != "" || spec.TextBody != "" {
+		return nil, fmt.Errorf("spec.bodyFormat %s applies to body and cannot be combined with htmlBody or textBody", spec.BodyFormat)
+	}
+
+	rendered := email.DeepCopy()
+	rendered.Spec.Body = ""
+	switch spec.BodyFormat {
+	case emailv1.BodyFormatHTML:
+		rendered.Spec.HTMLBody = spec.Body
+	case emailv1.BodyFormatMarkdown:
+		var content bytes.Buffer
+		if err := markdown.Convert([]byte(spec.Body), &content); err != nil {
+			return nil, fmt.Errorf("failed to render Markdown body: %w", err)
+		}
+		// The text alternative comes from the content alone, without the
+		// layout's header and footer.
+		text, err := htmlToText(content.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate text body from Markdown: %w", err)
+		}
+		html, err := r.applyLayout(ctx, email, config, layoutData{
+			Subject: spec.Subject,
+			Content: htmltemplate.HTML(content.String()),
+		})
+		if err != nil {
+			return nil, err
+		}
+		rendered.Spec.HTMLBody = html
+		rendered.Spec.TextBody = text
+	default:
+		return nil, fmt.Errorf("unknown spec.bodyFormat %q", spec.BodyFormat)
+	}
+	return rendered, nil
+}
+
+// applyLayout wraps rendered Markdown in the Email's layoutRef template or,
+// failing that, the sender config's layout. Without either the content is
+// sent as is.
+func (r *EmailReconciler) applyLayout(ctx context.Context, email *emailv1.Email, config *emailv1.EmailSenderConfig, data layoutData) (string, error) {
+	layout, field := config.Spec.Layout, "layout"
+	if email.Spec.LayoutRef != "" {
+		var tmpl emailv1.EmailTemplate
+		if err := r.Get(ctx, client.ObjectKey{Name: email.Spec.LayoutRef, Namespace: email.Namespace}, &tmpl); err != nil {
+			return "", fmt.Errorf("failed to get layout EmailTemplate %s: %w", email.Spec.LayoutRef, err)
+		}
+		if tmpl.Spec.HTMLBody == "" {
+			return "", fmt.Errorf("layout EmailTemplate %s has no htmlBody", tmpl.Name)
+		}
+		layout, field = tmpl.Spec.HTMLBody, "htmlBody"
+	}
+	if layout == "" {
+		return string(data.Content), nil
+	}
+
+	html, err := renderHTML(field, layout, data)
+	if err != nil {
+		if email.Spec.LayoutRef != "" {
+			return "", fmt.Errorf("layout EmailTemplate %s: %w", email.Spec.LayoutRef, err)
+		}
+		return "", fmt.Errorf("EmailSenderConfig %s: %w", config.Name, err)
+	}
+	return html, nil
+}
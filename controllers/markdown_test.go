@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Markdown bodies", func() {
+	var (
+		ctx    context.Context
+		r      *EmailReconciler
+		config *emailv1.EmailSenderConfig
+		email  *emailv1.Email
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		r = &EmailReconciler{
+			Client: fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+				&emailv1.EmailTemplate{
+					ObjectMeta: metav1.ObjectMeta{Name: "branded", Namespace: "default"},
+					Spec: emailv1.EmailTemplateSpec{
+						Subject:  "unused",
+						HTMLBody: `<div class="brand">{{ .Content }}</div>`,
+					},
+				},
+			).Build(),
+		}
+		config = &emailv1.EmailSenderConfig{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}}
+		email = &emailv1.Email{
+			ObjectMeta: metav1.ObjectMeta{Name: "email", Namespace: "default"},
+			Spec: emailv1.EmailSpec{
+				Subject:    "Release <1.2>",
+				BodyFormat: emailv1.BodyFormatMarkdown,
+				Body:       "# Shipped\n\nSee the [notes](https://example.com/notes).\n\n<script>alert(1)</script>\n\n[bad](javascript:alert(1))\n",
+			},
+		}
+	})
+
+	It("renders sanitized HTML and a plain-text alternative", func() {
+		rendered, err := r.renderBodyFormat(ctx, email, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Spec.Body).To(BeEmpty())
+		Expect(rendered.Spec.HTMLBody).To(ContainSubstring("<h1>Shipped</h1>"))
+		Expect(rendered.Spec.HTMLBody).To(ContainSubstring(`<a href="https://example.com/notes">notes</a>`))
+		Expect(rendered.Spec.HTMLBody).NotTo(ContainSubstring("<script>"))
+		Expect(rendered.Spec.HTMLBody).NotTo(ContainSubstring("javascript:"))
+		Expect(rendered.Spec.TextBody).To(ContainSubstring("Shipped"))
+		Expect(rendered.Spec.TextBody).To(ContainSubstring("notes (https://example.com/notes)"))
+		Expect(email.Spec.Body).NotTo(BeEmpty())
+	})
+
+	It("wraps the HTML in the sender config's layout", func() {
+		config.Spec.Layout = "<html><head><title>{{ .Subject }}</title></head><body>{{ .Content }}</body></html>"
+		rendered, err := r.renderBodyFormat(ctx, email, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Spec.HTMLBody).To(HavePrefix("<html><head><title>Release &lt;1.2&gt;</title></head><body><h1>Shipped</h1>"))
+		Expect(rendered.Spec.TextBody).NotTo(ContainSubstring("Release"))
+	})
+
+	It("prefers the Email's layout template", func() {
+		config.Spec.Layout = "<body>{{ .Content }}</body>"
+		email.Spec.LayoutRef = "branded"
+		rendered, err := r.renderBodyFormat(ctx, email, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Spec.HTMLBody).To(HavePrefix(`<div class="brand"><h1>Shipped</h1>`))
+
+		email.Spec.LayoutRef = "missing"
+		_, err = r.renderBodyFormat(ctx, email, config)
+		Expect(err).To(MatchError(ContainSubstring("failed to get layout EmailTemplate missing")))
+	})
+
+	It("reports layout errors with their location", func() {
+		config.Spec.Layout = "<body>\n{{ .Contnet }}</body>"
+		_, err := r.renderBodyFormat(ctx, email, config)
+		Expect(err).To(MatchError(ContainSubstring("EmailSenderConfig config: layout: line 2, column 3: ")))
+	})
+
+	It("sends html bodies as HTML and leaves text bodies alone", func() {
+		email.Spec.BodyFormat = emailv1.BodyFormatHTML
+		email.Spec.Body = "<p>Hi</p>"
+		rendered, err := r.renderBodyFormat(ctx, email, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Spec.HTMLBody).To(Equal("<p>Hi</p>"))
+
+		email.Spec.BodyFormat = emailv1.BodyFormatText
+		Expect(r.renderBodyFormat(ctx, email, config)).To(BeIdenticalTo(email))
+	})
+
+	It("cannot be combined with htmlBody or textBody", func() {
+		email.Spec.TextBody = "Hi"
+		_, err := r.renderBodyFormat(ctx, email, config)
+		Expect(err).To(MatchError(ContainSubstring("cannot be combined with htmlBody or textBody")))
+	})
+})
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// buildMIME renders msg as an RFC 5322 message with the given Message-ID.
+func buildMIME(msg *Message, messageID string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writeHeader(&buf, "From", msg.From.String())
+	// Bcc recipients only appear in the envelope, so a message sent only
+	// to them gets the conventional empty group instead of an empty To.
+	if len(msg.To) > 0 {
+		writeHeader(&buf, "To", joinAddresses(msg.To))
+	} else {
+		writeHeader(&buf, "To", "undisclosed-recipients:;")
+	}
+	if len(msg.Cc) > 0 {
+		writeHeader(&buf, "Cc", joinAddresses(msg.Cc))
+	}
+	if msg.ReplyTo != nil {
+		writeHeader(&buf, "Reply-To", msg.ReplyTo.String())
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID)
+	for _, name := range sortedHeaderNames(msg.Headers) {
+		writeHeader(&buf, name, mime.QEncoding.Encode("utf-8", msg.Headers[name]))
+	}
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	body := messageBody(msg, messageID)
+	for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if v := body.header.Get(key); v != "" {
+			writeHeader(&buf, key, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	if err := body.write(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// mimePart is a MIME entity: its Content-* headers and a body writer.
+type mimePart struct {
+	header textproto.MIMEHeader
+	write  func(io.Writer) error
+}
+
+// messageBody nests the parts of msg as mail clients expect:
+// multipart/mixed holds the body and regular attachments, multipart/related
+// holds the body and the inline images it references, and
+// multipart/alternative holds the text and HTML versions of the body.
+// Boundaries are derived from messageID, so the same message with the same
+// Message-ID renders the same bytes.
+func messageBody(msg *Message, messageID string) mimePart {
+	var body mimePart
+	switch {
+	case msg.HTML != "" && msg.Text != "":
+		body = multipartPart(messageID, "alternative", textPart("text/plain", msg.Text), textPart("text/html", msg.HTML))
+	case msg.HTML != "":
+		body = textPart("text/html", msg.HTML)
+	default:
+		body = textPart("text/plain", msg.Text)
+	}
+
+	var inline, attached []mimePart
+	for _, a := range msg.Attachments {
+		if a.Inline {
+			inline = append(inline, attachmentPart(a))
+		} else {
+			attached = append(attached, attachmentPart(a))
+		}
+	}
+	if len(inline) > 0 {
+		body = multipartPart(messageID, "related", append([]mimePart{body}, inline...)...)
+	}
+	if len(attached) > 0 {
+		body = multipartPart(messageID, "mixed", append([]mimePart{body}, attached...)...)
+	}
+	return body
+}
+
+func multipartPart(messageID, subtype string, parts ...mimePart) mimePart {
+	sum := sha256.Sum256([]byte(messageID + "/" + subtype))
+	boundary := hex.EncodeToString(sum[:15])
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}))
+	return mimePart{header: h, write: func(w io.Writer) error {
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(boundary); err != nil {
+			return err
+		}
+		for _, p := range parts {
+			pw, err := mw.CreatePart(p.header)
+			if err != nil {
+				return err
+			}
+			if err := p.write(pw); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}}
+}
+
+func textPart(contentType, body string) mimePart {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"charset": "utf-8"}))
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return mimePart{header: h, write: func(w io.Writer) error {
+		qw := quotedprintable.NewWriter(w)
+		if _, err := io.WriteString(qw, body); err != nil {
+			return err
+		}
+		return qw.Close()
+	}}
+}
+
+func attachmentPart(a Attachment) mimePart {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Filename}))
+	h.Set("Content-Transfer-Encoding", "base64")
+	disposition := "attachment"
+	if a.Inline {
+		disposition = "inline"
+		h.Set("Content-ID", "<"+a.ContentID+">")
+	}
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	return mimePart{header: h, write: func(w io.Writer) error {
+		return writeBase64Lines(w, a.Data)
+	}}
+}
+
+// writeBase64Lines writes data base64 encoded in 76 character lines, as
+// RFC 2045 requires.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	const lineLen = 76
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := lineLen
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// messageIDFor returns the Message-ID of msg. It is derived from the
+// idempotency key when there is one, so a resent attempt keeps the
+// Message-ID receivers deduplicate on.
+func messageIDFor(msg *Message) string {
+	if msg.IdempotencyKey != "" {
+		return fmt.Sprintf("<%s@%s>", msg.IdempotencyKey, messageIDDomain(msg.From.Email))
+	}
+	return newMessageID(msg.From.Email)
+}
+
+// newMessageID returns a unique Message-ID in the domain of the sender address.
+func newMessageID(from string) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), messageIDDomain(from))
+}
+
+// messageIDDomain returns the domain of the sender address for Message-IDs.
+func messageIDDomain(from string) string {
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		return from[i+1:]
+	}
+	return "localhost"
+}
+
+func writeHeader(w io.Writer, key, value string) {
+	fmt.Fprintf(w, "%s: %s\r\n", key, value)
+}
+
+func joinAddresses(addrs []Address) string {
+	parts := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(parts, ", ")
+}
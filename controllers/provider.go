@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// Provider sends email through a transactional email service.
+type Provider interface {
+	// Name returns the name the provider is registered under.
+	Name() string
+	// Validate checks that the provider has everything it needs to send,
+	// without contacting the remote service.
+	Validate() error
+	// Send dispatches the message and returns the provider's message id.
+	Send(ctx context.Context, msg *Message) (string, error)
+}
+
+// RetryableError wraps a provider error that may succeed if the send is
+// retried later, such as throttling.
+type RetryableError struct {
+	Err error
+	// RetryAfter is how long the provider asked us to wait, if it said.
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// asRetryable returns the RetryableError in err's chain, or nil.
+func asRetryable(err error) *RetryableError {
+	var retryable *RetryableError
+	if errors.As(err, &retryable) {
+		return retryable
+	}
+	return nil
+}
+
+// isRetryable reports whether a send error is transient: errors marked
+// retryable by the provider, HTTP 429 and 5xx responses, SMTP 4xx replies,
+// timeouts and failures to connect.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if asRetryable(err) != nil {
+		return true
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code/100 == 4
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Address is a mailbox with an optional display name.
+type Address struct {
+	Name  string
+	Email string
+}
+
+// String renders the address in RFC 5322 form.
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Email
+	}
+	return (&mail.Address{Name: a.Name, Address: a.Email}).String()
+}
+
+// Message is the provider independent form of an Email.
+type Message struct {
+	From    Address
+	ReplyTo *Address
+	To      []Address
+	Cc      []Address
+	Bcc     []Address
+	Subject string
+	HTML    string
+	Text    string
+
+	// Headers are extra message headers keyed by canonical name.
+	Headers map[string]string
+
+	Attachments []Attachment
+
+	// Template, when set, replaces HTML and Text with a template hosted by
+	// the provider.
+	Template *ProviderTemplate
+
+	// IdempotencyKey identifies the send attempt. Providers pass it on where
+	// they can, so that resending an attempt that may already have been
+	// accepted does not deliver the email twice.
+	IdempotencyKey string
+
+	// SendAt, when set, asks the provider to hold the message until then.
+	// It is only set for providers that implement scheduler.
+	SendAt time.Time
+}
+
+// ProviderTemplate is a template hosted by the provider and the variables to
+// render it with.
+type ProviderTemplate struct {
+	ID        string
+	Variables map[string]interface{}
+	// Personalization holds per-recipient variables keyed by address.
+	Personalization map[string]map[string]interface{}
+}
+
+// VariablesFor returns the variables of one recipient: Variables overridden
+// by the recipient's personalization.
+func (t *ProviderTemplate) VariablesFor(email string) map[string]interface{} {
+	vars := make(map[string]interface{}, len(t.Variables))
+	for k, v := range t.Variables {
+		vars[k] = v
+	}
+	for k, v := range t.Personalization[strings.ToLower(email)] {
+		vars[k] = v
+	}
+	return vars
+}
+
+// Attachment is a file sent with a Message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	// Inline attachments are shown in the HTML body, which refers to them
+	// as cid:ContentID.
+	Inline    bool
+	ContentID string
+	Data      []byte
+}
+
+// Recipients returns every envelope recipient: To, then Cc, then Bcc.
+func (m *Message) Recipients() []Address {
+	out := make([]Address, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	out = append(out, m.To...)
+	out = append(out, m.Cc...)
+	return append(out, m.Bcc...)
+}
+
+// RecipientResult is a provider's verdict on one recipient of a message.
+type RecipientResult struct {
+	Email string
+	// Err is why the recipient was rejected, or nil if it was accepted.
+	Err error
+}
+
+// recipientReporter is implemented by providers that learn whether each
+// recipient was accepted, such as SMTP servers answering RCPT TO.
+type recipientReporter interface {
+	Provider
+	// SendReportingRecipients is Send that also returns the verdict on each
+	// recipient. A message accepted for only some recipients is not an error.
+	SendReportingRecipients(ctx context.Context, msg *Message) (string, []RecipientResult, error)
+}
+
+// templateProvider is implemented by providers that can send templates
+// they host.
+type templateProvider interface {
+	Provider
+	providerTemplates()
+}
+
+// supportsTemplates reports whether provider can send a Message.Template.
+func supportsTemplates(provider Provider) bool {
+	_, ok := provider.(templateProvider)
+	return ok
+}
+
+// toRequirer is implemented by providers whose API rejects messages
+// without a To recipient, such as Bcc-only messages.
+type toRequirer interface {
+	Provider
+	requiresTo()
+}
+
+// requiresTo reports whether provider needs a Message with a To recipient.
+func requiresTo(provider Provider) bool {
+	_, ok := provider.(toRequirer)
+	return ok
+}
+
+// sentFinder is implemented by providers that can look up a message by the
+// idempotency key it was sent with.
+type sentFinder interface {
+	Provider
+	// FindSent returns the message id of the message sent with key, and
+	// false if the provider has no record of one.
+	FindSent(ctx context.Context, key string) (string, bool, error)
+}
+
+// verifier is implemented by providers that can check their credentials
+// with the remote service.
+type verifier interface {
+	Provider
+	// Verify checks that the credentials are accepted and, when domain is
+	// set and the provider tracks sending domains, that mail may be sent
+	// from it. Domains the provider will not send from are reported with
+	// errDomainNotVerified in the error's chain.
+	Verify(ctx context.Context, domain string) error
+}
+
+// errDomainNotVerified marks verifier errors about the sending domain rather
+// than the credentials.
+var errDomainNotVerified = errors.New("domain is not verified")
+
+// scheduler is implemented by providers that can hold a message until
+// Message.SendAt.
+type scheduler interface {
+	Provider
+	// maxScheduleAhead is how far in the future SendAt may be.
+	maxScheduleAhead() time.Duration
+}
+
+// canSchedule reports whether provider can hold a message for wait.
+func canSchedule(provider Provider, wait time.Duration) bool {
+	s, ok := provider.(scheduler)
+	return ok && wait <= s.maxScheduleAhead()
+}
+
+// send sends msg through provider, returning per-recipient results when the
+// provider reports them.
+func send(ctx context.Context, provider Provider, msg *Message) (string, []RecipientResult, error) {
+	if reporter, ok := provider.(recipientReporter); ok {
+		return reporter.SendReportingRecipients(ctx, msg)
+	}
+	messageID, err := provider.Send(ctx, msg)
+	return messageID, nil, err
+}
+
+// ProviderConfig holds what a ProviderFactory needs to build a Provider.
+type ProviderConfig struct {
+	// Spec is the EmailSenderConfig the provider is built for.
+	Spec emailv1.EmailSenderConfigSpec
+	// Secret is the data of the Secret referenced by the sender config.
+	Secret map[string][]byte
+}
+
+// secretValue returns the referenced Secret's value for key as a string.
+func (c ProviderConfig) secretValue(key string) string {
+	return string(c.Secret[key])
+}
+
+// ProviderFactory builds a Provider from a sender configuration.
+type ProviderFactory func(config ProviderConfig) (Provider, error)
+
+// ProviderRegistry maps provider names to the factories that build them.
+type ProviderRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]ProviderFactory
+}
+
+// NewProviderRegistry returns an empty ProviderRegistry.
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{factories: map[string]ProviderFactory{}}
+}
+
+// Register adds a factory under name, replacing any existing registration.
+func (r *ProviderRegistry) Register(name string, factory ProviderFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
+
+// New builds and validates the provider registered under name.
+func (r *ProviderRegistry) New(name string, config ProviderConfig) (Provider, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown email provider %q", name)
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s provider: %w", name, err)
+	}
+	if err := provider.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s provider configuration: %w", name, err)
+	}
+	return provider, nil
+}
+
+// Names returns the registered provider names in sorted order.
+func (r *ProviderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultProviders is the registry used by EmailReconciler when none is set.
+var DefaultProviders = NewProviderRegistry()
+
+func init() {
+	DefaultProviders.Register(string(emailv1.ProviderMailerSend), newMailerSendProvider)
+	DefaultProviders.Register(string(emailv1.ProviderMailgun), newMailgunProvider)
+	DefaultProviders.Register(string(emailv1.ProviderSMTP), newSMTPProvider)
+	DefaultProviders.Register(string(emailv1.ProviderSendGrid), newSendGridProvider)
+	DefaultProviders.Register(string(emailv1.ProviderPostmark), newPostmarkProvider)
+	DefaultProviders.Register(string(emailv1.ProviderSES), newSESProvider)
+	DefaultProviders.Register(string(emailv1.ProviderWebhook), newWebhookProvider)
+	DefaultProviders.Register(string(emailv1.ProviderLog), newLogProvider)
+}
+
+// providerName returns the provider selected by a sender config or backend.
+func providerName(settings emailv1.ProviderSettings) string {
+	if settings.Provider == "" {
+		return string(emailv1.ProviderMailerSend)
+	}
+	return string(settings.Provider)
+}
+
+// newMessage builds the provider independent message for an Email. It fails
+// if the Email has no recipients or any recipient address is invalid.
+func newMessage(email *emailv1.Email, fromEmail string) (*Message, error) {
+	msg := &Message{
+		From:    Address{Name: email.Spec.FromName, Email: fromEmail},
+		Subject: email.Spec.Subject,
+		HTML:    email.Spec.HTMLBody,
+		Text:    email.Spec.TextBody,
+	}
+	var err error
+	if msg.ReplyTo, err = replyToAddress("spec.replyTo", email.Spec.ReplyTo); err != nil {
+		return nil, err
+	}
+	if msg.Headers, err = messageHeaders(email.Spec.Headers); err != nil {
+		return nil, err
+	}
+	if email.Spec.ProviderTemplate != nil {
+		if msg.Template, err = newProviderTemplate(email.Spec); err != nil {
+			return nil, err
+		}
+	} else {
+		if msg.HTML == "" && msg.Text == "" {
+			msg.Text = email.Spec.Body
+		}
+		if msg.Text == "" && msg.HTML != "" {
+			text, err := htmlToText(msg.HTML)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate text body from htmlBody: %w", err)
+			}
+			msg.Text = text
+		}
+	}
+	if email.Spec.RecipientEmail != "" {
+		msg.To = append(msg.To, Address{Email: email.Spec.RecipientEmail})
+	}
+
+	if msg.To, err = appendAddresses(msg.To, "to", email.Spec.To); err != nil {
+		return nil, err
+	}
+	if msg.Cc, err = appendAddresses(msg.Cc, "cc", email.Spec.Cc); err != nil {
+		return nil, err
+	}
+	if msg.Bcc, err = appendAddresses(msg.Bcc, "bcc", email.Spec.Bcc); err != nil {
+		return nil, err
+	}
+	if len(msg.Recipients()) == 0 {
+		return nil, errors.New("email has no recipients")
+	}
+	for _, rcpt := range msg.Recipients() {
+		if _, err := mail.ParseAddress(rcpt.Email); err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", rcpt.Email, err)
+		}
+	}
+	return msg, nil
+}
+
+// newProviderTemplate converts the providerTemplate of an Email.
+func newProviderTemplate(spec emailv1.EmailSpec) (*ProviderTemplate, error) {
+	if spec.HTMLBody != "" || spec.TextBody != "" || spec.Body != "" || spec.TemplateRef != "" {
+		return nil, errors.New("spec.providerTemplate cannot be combined with htmlBody, textBody, body or templateRef")
+	}
+	if spec.ProviderTemplate.ID == "" {
+		return nil, errors.New("spec.providerTemplate.id is required")
+	}
+	vars, err := decodeTemplateData(spec.ProviderTemplate.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("spec.providerTemplate.variables: %w", err)
+	}
+	t := &ProviderTemplate{ID: spec.ProviderTemplate.ID, Variables: vars}
+	for i, p := range spec.ProviderTemplate.Personalization {
+		if p.Email == "" {
+			return nil, fmt.Errorf("spec.providerTemplate.personalization[%d].email is required", i)
+		}
+		vars, err := decodeTemplateData(p.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("spec.providerTemplate.personalization[%d].variables: %w", i, err)
+		}
+		if t.Personalization == nil {
+			t.Personalization = make(map[string]map[string]interface{})
+		}
+		t.Personalization[strings.ToLower(p.Email)] = vars
+	}
+	return t, nil
+}
+
+// appendAddresses converts the addresses of an Email recipient list.
+func appendAddresses(out []Address, field string, addrs []emailv1.EmailAddress) ([]Address, error) {
+	for i, a := range addrs {
+		if a.Email == "" {
+			return nil, fmt.Errorf("spec.%s[%d].email is required", field, i)
+		}
+		out = append(out, Address{Name: a.Name, Email: a.Email})
+	}
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// CapturedMessage is a message kept by the Capture provider.
+type CapturedMessage struct {
+	ID         string
+	CapturedAt time.Time
+	Provider   string
+	From       Address
+	ReplyTo    *Address
+	To         []Address
+	Cc         []Address
+	Bcc        []Address
+	Subject    string
+	HTML       string
+	Text       string
+	Raw        []byte
+	// Attachments lists the attached files.
+	Attachments []Attachment
+}
+
+// CaptureStore keeps the most recent captured messages in a bounded ring buffer.
+type CaptureStore struct {
+	mu       sync.RWMutex
+	messages []*CapturedMessage
+	next     int
+	full     bool
+}
+
+// NewCaptureStore returns a CaptureStore holding at most size messages.
+func NewCaptureStore(size int) *CaptureStore {
+	if size < 1 {
+		size = 1
+	}
+	return &CaptureStore{messages: make([]*CapturedMessage, size)}
+}
+
+// Add stores m, evicting the oldest message when the buffer is full.
+func (s *CaptureStore) Add(m *CapturedMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[s.next] = m
+	s.next = (s.next + 1) % len(s.messages)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// List returns the stored messages, newest first.
+func (s *CaptureStore) List() []*CapturedMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := s.next
+	if s.full {
+		n = len(s.messages)
+	}
+	out := make([]*CapturedMessage, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, s.messages[(s.next-i+len(s.messages))%len(s.messages)])
+	}
+	return out
+}
+
+// Get returns the stored message with the given id.
+func (s *CaptureStore) Get(id string) (*CapturedMessage, bool) {
+	for _, m := range s.List() {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// NewProvider is a ProviderFactory for Capture providers backed by s.
+func (s *CaptureStore) NewProvider(config ProviderConfig) (Provider, error) {
+	return &captureProvider{store: s}, nil
+}
+
+// captureProvider stores rendered messages in a CaptureStore instead of
+// sending them, for development clusters.
+type captureProvider struct {
+	store *CaptureStore
+}
+
+func (p *captureProvider) Name() string {
+	return string(emailv1.ProviderCapture)
+}
+
+func (p *captureProvider) Validate() error {
+	return nil
+}
+
+func (p *captureProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	messageID, raw, err := renderMessage(msg, time.Now())
+	if err != nil {
+		return "", err
+	}
+	p.store.Add(&CapturedMessage{
+		ID:         messageID,
+		CapturedAt: time.Now(),
+		Provider:   p.Name(),
+		From:       msg.From,
+		ReplyTo:    msg.ReplyTo,
+		To:         msg.To,
+		Cc:         msg.Cc,
+		Bcc:        msg.Bcc,
+		Subject:    msg.Subject,
+		HTML:       msg.HTML,
+		Text:       msg.Text,
+		Raw:        raw,
+
+		Attachments: msg.Attachments,
+	})
+	log.FromContext(ctx).Info("Email captured", "messageID", messageID, "recipients", msg.Recipients(), "subject", msg.Subject)
+	return messageID, nil
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Capture provider", func() {
+	var store *CaptureStore
+
+	BeforeEach(func() {
+		store = NewCaptureStore(2)
+	})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		store.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	It("keeps the newest messages in a bounded buffer", func() {
+		p, err := store.NewProvider(ProviderConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		for _, subject := range []string{"one", "two", "three"} {
+			msg := contractMessage()
+			msg.Subject = subject
+			_, err := p.Send(context.Background(), msg)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		list := store.List()
+		Expect(list).To(HaveLen(2))
+		Expect(list[0].Subject).To(Equal("three"))
+		Expect(list[1].Subject).To(Equal("two"))
+	})
+
+	It("serves the inbox, message details and each body", func() {
+		p, _ := store.NewProvider(ProviderConfig{})
+		id, err := p.Send(context.Background(), contractMessage())
+		Expect(err).NotTo(HaveOccurred())
+		query := "?id=" + url.QueryEscape(id)
+
+		inbox := get("/")
+		Expect(inbox.Code).To(Equal(http.StatusOK))
+		Expect(inbox.Body.String()).To(ContainSubstring("Hello"))
+
+		details := get("/message" + query)
+		Expect(details.Code).To(Equal(http.StatusOK))
+		Expect(details.Body.String()).To(ContainSubstring("recipient@example.com"))
+		Expect(details.Body.String()).To(ContainSubstring("oncall@example.com"))
+
+		html := get("/message/html" + query)
+		Expect(html.Body.String()).To(Equal("<p>World</p>"))
+		Expect(html.Header().Get("Content-Security-Policy")).To(Equal("sandbox"))
+
+		Expect(get("/message/text" + query).Body.String()).To(Equal("World"))
+		raw := get("/message/raw" + query).Body.String()
+		Expect(raw).To(ContainSubstring("Message-ID: " + id))
+		Expect(raw).To(ContainSubstring("Cc: \"On-call\" <oncall@example.com>"))
+		Expect(raw).NotTo(ContainSubstring("audit@example.com"))
+	})
+
+	It("returns 404 for unknown messages", func() {
+		Expect(get("/message?id=missing").Code).To(Equal(http.StatusNotFound))
+	})
+})
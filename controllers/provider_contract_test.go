@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// contractMessage is the message every HTTP provider contract test sends.
+func contractMessage() *Message {
+	return &Message{
+		From:    Address{Name: "Operator", Email: "sender@example.com"},
+		To:      []Address{{Name: "Recipient", Email: "recipient@example.com"}},
+		Cc:      []Address{{Name: "On-call", Email: "oncall@example.com"}},
+		Bcc:     []Address{{Email: "audit@example.com"}},
+		Subject: "Hello",
+		HTML:    "<p>World</p>",
+		Text:    "World",
+	}
+}
+
+// decodeJSON decodes the request body, failing the spec on error.
+func decodeJSON(r *http.Request, v interface{}) {
+	Expect(json.NewDecoder(r.Body).Decode(v)).To(Succeed())
+}
+
+var _ = Describe("SendGrid provider contract", func() {
+	It("maps the message onto /v3/mail/send and reads X-Message-Id", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/v3/mail/send"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer key"))
+
+			var body sendGridMessage
+			decodeJSON(r, &body)
+			Expect(body.From).To(Equal(sendGridAddress{Email: "sender@example.com", Name: "Operator"}))
+			Expect(body.Personalizations).To(HaveLen(1))
+			Expect(body.Personalizations[0].To).To(Equal([]sendGridAddress{{Email: "recipient@example.com", Name: "Recipient"}}))
+			Expect(body.Personalizations[0].Cc).To(Equal([]sendGridAddress{{Email: "oncall@example.com", Name: "On-call"}}))
+			Expect(body.Personalizations[0].Bcc).To(Equal([]sendGridAddress{{Email: "audit@example.com"}}))
+			Expect(body.Subject).To(Equal("Hello"))
+			Expect(body.Content).To(Equal([]sendGridContent{
+				{Type: "text/plain", Value: "World"},
+				{Type: "text/html", Value: "<p>World</p>"},
+			}))
+
+			w.Header().Set("X-Message-Id", "sg-123")
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		p := &sendGridProvider{apiKey: "key", baseURL: server.URL + "/v3", client: server.Client()}
+		id, err := p.Send(context.Background(), contractMessage())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("sg-123"))
+	})
+
+	It("returns the status code of rejected requests", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"rate limited"}]}`))
+		}))
+		defer server.Close()
+
+		p := &sendGridProvider{apiKey: "key", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), contractMessage())
+		var statusErr *httpStatusError
+		Expect(err).To(BeAssignableToTypeOf(statusErr))
+		Expect(err.(*httpStatusError).StatusCode).To(Equal(http.StatusTooManyRequests))
+	})
+})
+
+var _ = Describe("Postmark provider contract", func() {
+	It("maps the message onto /email and reads MessageID", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/email"))
+			Expect(r.Header.Get("X-Postmark-Server-Token")).To(Equal("token"))
+
+			var body postmarkMessage
+			decodeJSON(r, &body)
+			Expect(body).To(Equal(postmarkMessage{
+				From:          `"Operator" <sender@example.com>`,
+				To:            `"Recipient" <recipient@example.com>`,
+				Cc:            `"On-call" <oncall@example.com>`,
+				Bcc:           "audit@example.com",
+				Subject:       "Hello",
+				TextBody:      "World",
+				HtmlBody:      "<p>World</p>",
+				MessageStream: "outbound",
+			}))
+
+			_, _ = w.Write([]byte(`{"To":"recipient@example.com","SubmittedAt":"2024-01-01T00:00:00Z","MessageID":"pm-123","ErrorCode":0,"Message":"OK"}`))
+		}))
+		defer server.Close()
+
+		p := &postmarkProvider{serverToken: "token", messageStream: "outbound", baseURL: server.URL, client: server.Client()}
+		id, err := p.Send(context.Background(), contractMessage())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("pm-123"))
+	})
+
+	It("reports API error codes", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"ErrorCode":300,"Message":"Invalid email request"}`))
+		}))
+		defer server.Close()
+
+		p := &postmarkProvider{serverToken: "token", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), contractMessage())
+		Expect(err).To(MatchError(ContainSubstring("Invalid email request")))
+	})
+})
+
+var _ = Describe("Webhook provider contract", func() {
+	newProvider := func(url, messageIDPath string) Provider {
+		p, err := DefaultProviders.New("Webhook", ProviderConfig{
+			Spec: emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{
+				Webhook: &emailv1.WebhookSpec{
+					URL: url,
+					Headers: []emailv1.WebhookHeader{
+						{Name: "X-Team", Value: "platform"},
+						{Name: "Authorization", SecretKey: "authorization"},
+					},
+					BodyTemplate:  `{"to":{{json (index .To 0).Email}},"subject":{{json .Subject}},"html":{{json .HTML}}}`,
+					MessageIDPath: messageIDPath,
+				},
+			}},
+			Secret: map[string][]byte{"authorization": []byte("Bearer gateway")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	It("renders the body template and extracts the message id", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(r.Header.Get("X-Team")).To(Equal("platform"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer gateway"))
+
+			var body map[string]string
+			decodeJSON(r, &body)
+			Expect(body).To(Equal(map[string]string{
+				"to":      "recipient@example.com",
+				"subject": "Hello",
+				"html":    "<p>World</p>",
+			}))
+
+			_, _ = w.Write([]byte(`{"result":{"messages":[{"id":"gw-123"}]}}`))
+		}))
+		defer server.Close()
+
+		for _, path := range []string{"result.messages.0.id", "$.result.messages[0].id", "{.result.messages[0].id}"} {
+			id, err := newProvider(server.URL, path).Send(context.Background(), contractMessage())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("gw-123"))
+		}
+	})
+
+	It("succeeds without a message id when the response lacks one", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}))
+		defer server.Close()
+
+		id, err := newProvider(server.URL, "id").Send(context.Background(), contractMessage())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(BeEmpty())
+	})
+
+	It("rejects headers whose secret key is missing", func() {
+		_, err := DefaultProviders.New("Webhook", ProviderConfig{
+			Spec: emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{
+				Webhook: &emailv1.WebhookSpec{
+					URL:          "http://gateway",
+					Headers:      []emailv1.WebhookHeader{{Name: "Authorization", SecretKey: "missing"}},
+					BodyTemplate: "{}",
+				},
+			}},
+		})
+		Expect(err).To(MatchError(ContainSubstring("secret key missing not found")))
+	})
+})
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// httpStatusError is returned when a provider API answers with a non-2xx status.
+type httpStatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s returned %d %s: %s", e.Provider, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// doHTTP sends req and returns the response and its body. A non-2xx status
+// is reported as an *httpStatusError.
+func doHTTP(client *http.Client, provider string, req *http.Request) (*http.Response, []byte, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		return res, body, &httpStatusError{
+			Provider:   provider,
+			StatusCode: res.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+	return res, body, nil
+}
+
+// postJSON POSTs payload as JSON to url with the given headers.
+func postJSON(ctx context.Context, client *http.Client, provider, url string, headers map[string]string, payload interface{}) (*http.Response, []byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return doHTTP(client, provider, req)
+}
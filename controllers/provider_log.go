@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// maxRenderedMessageSize caps how much of a rendered message is kept in status.
+const maxRenderedMessageSize = 32 * 1024
+
+// dryRunProvider is implemented by providers that never dispatch mail. The
+// reconciler records the rendered message instead of marking the Email Sent,
+// and hands it to the provider to show.
+type dryRunProvider interface {
+	Provider
+	// showRendered is given each message the reconciler renders instead of
+	// sending.
+	showRendered(ctx context.Context, messageID string, msg *Message, raw []byte)
+}
+
+// logProvider renders messages and writes them to the operator log instead
+// of sending them.
+type logProvider struct{}
+
+func newLogProvider(config ProviderConfig) (Provider, error) {
+	return &logProvider{}, nil
+}
+
+func (p *logProvider) Name() string {
+	return string(emailv1.ProviderLog)
+}
+
+func (p *logProvider) Validate() error {
+	return nil
+}
+
+func (p *logProvider) showRendered(ctx context.Context, messageID string, msg *Message, raw []byte) {
+	log.FromContext(ctx).Info("Dry run, not sending email", "messageID", messageID, "bcc", msg.Bcc, "message", string(raw))
+}
+
+// Send renders and logs msg. The reconciler does not call it, as it renders
+// Log provider Emails as dry runs.
+func (p *logProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	messageID, raw, err := renderMessage(msg, time.Now())
+	if err != nil {
+		return "", err
+	}
+	p.showRendered(ctx, messageID, msg, raw)
+	return messageID, nil
+}
+
+// isDryRun reports whether provider only pretends to send.
+func isDryRun(provider Provider) bool {
+	_, ok := provider.(dryRunProvider)
+	return ok
+}
+
+// renderMessage renders msg exactly as it would be sent over SMTP, dated
+// date.
+func renderMessage(msg *Message, date time.Time) (string, []byte, error) {
+	messageID := messageIDFor(msg)
+	raw, err := buildMIME(msg, messageID, date)
+	if err != nil {
+		return "", nil, err
+	}
+	return messageID, raw, nil
+}
+
+// truncateRendered shortens a rendered message so it fits in status.
+func truncateRendered(raw []byte) string {
+	if len(raw) <= maxRenderedMessageSize {
+		return string(raw)
+	}
+	return string(raw[:maxRenderedMessageSize]) + "\r\n[truncated]"
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mailersend/mailersend-go"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// mailerSendProvider sends email through the MailerSend API.
+type mailerSendProvider struct {
+	apiToken string
+	// client overrides the SDK's HTTP client.
+	client *http.Client
+}
+
+const (
+	// mailerSendAttemptTag prefixes the tag the idempotency key is sent as.
+	mailerSendAttemptTag = "attempt-"
+	// mailerSendFindWindow is how far back FindSent searches the account's
+	// activity.
+	mailerSendFindWindow = 72 * time.Hour
+)
+
+// mailerSendHeader is an entry of the headers field of a MailerSend send
+// request, which the SDK's Message cannot carry.
+type mailerSendHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// mailerSendHeaders is an http.RoundTripper that adds headers to the JSON
+// body of the requests it sends.
+type mailerSendHeaders struct {
+	base    http.RoundTripper
+	headers []mailerSendHeader
+}
+
+func (t *mailerSendHeaders) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload["headers"], err = json.Marshal(t.headers); err != nil {
+		return nil, err
+	}
+	if body, err = json.Marshal(payload); err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return t.base.RoundTrip(req)
+}
+
+func newMailerSendProvider(config ProviderConfig) (Provider, error) {
+	return &mailerSendProvider{apiToken: config.secretValue("api-token")}, nil
+}
+
+func (p *mailerSendProvider) Name() string {
+	return string(emailv1.ProviderMailerSend)
+}
+
+func (p *mailerSendProvider) providerTemplates() {}
+
+func (p *mailerSendProvider) requiresTo() {}
+
+// maxScheduleAhead is the 72 hour limit MailerSend puts on send_at.
+func (p *mailerSendProvider) maxScheduleAhead() time.Duration {
+	return 72 * time.Hour
+}
+
+func (p *mailerSendProvider) Validate() error {
+	if p.apiToken == "" {
+		return errors.New("secret key api-token is empty")
+	}
+	return nil
+}
+
+func (p *mailerSendProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	log := log.FromContext(ctx)
+
+	log.Info("Creating MailerSend client")
+	ms := mailersend.NewMailersend(p.apiToken)
+	client := p.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(msg.Headers) > 0 {
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		headers := &mailerSendHeaders{base: transport}
+		for _, name := range sortedHeaderNames(msg.Headers) {
+			headers.headers = append(headers.headers, mailerSendHeader{Name: name, Value: msg.Headers[name]})
+		}
+		withHeaders := *client
+		withHeaders.Transport = headers
+		client = &withHeaders
+	}
+	ms.SetClient(client)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	from := mailersend.From{
+		Name:  msg.From.Name,
+		Email: msg.From.Email,
+	}
+
+	recipients := mailerSendRecipients(msg.To)
+
+	message := ms.Email.NewMessage()
+
+	message.SetFrom(from)
+	if msg.ReplyTo != nil {
+		message.SetReplyTo(mailersend.Recipient{Name: msg.ReplyTo.Name, Email: msg.ReplyTo.Email})
+	}
+	message.SetRecipients(recipients)
+	if len(msg.Cc) > 0 {
+		message.SetCc(mailerSendRecipients(msg.Cc))
+	}
+	if len(msg.Bcc) > 0 {
+		message.SetBcc(mailerSendRecipients(msg.Bcc))
+	}
+	message.SetSubject(msg.Subject)
+	if msg.IdempotencyKey != "" {
+		message.SetTags([]string{mailerSendAttemptTag + msg.IdempotencyKey})
+	}
+	message.SetHTML(msg.HTML)
+	message.SetText(msg.Text)
+	if !msg.SendAt.IsZero() {
+		message.SetSendAt(msg.SendAt.Unix())
+	}
+	if msg.Template != nil {
+		// MailerSend has no global template variables, so every recipient
+		// gets the shared ones in its personalization.
+		message.SetTemplateID(msg.Template.ID)
+		var personalization []mailersend.Personalization
+		for _, rcpt := range msg.Recipients() {
+			personalization = append(personalization, mailersend.Personalization{
+				Email: rcpt.Email,
+				Data:  msg.Template.VariablesFor(rcpt.Email),
+			})
+		}
+		message.SetPersonalization(personalization)
+	}
+	for _, a := range msg.Attachments {
+		attachment := mailersend.Attachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Data),
+			Filename:    a.Filename,
+			Disposition: mailersend.DispositionAttachment,
+		}
+		if a.Inline {
+			attachment.Disposition = mailersend.DispositionInline
+			attachment.ID = a.ContentID
+		}
+		message.AddAttachment(attachment)
+	}
+
+	log.Info("Sending email with MailerSend", "from", from, "recipients", msg.Recipients(), "subject", msg.Subject)
+
+	res, err := ms.Email.Send(ctx, message)
+	if err != nil {
+		log.Error(err, "Failed to send email with MailerSend")
+		return "", mailerSendError(err)
+	}
+
+	messageID := res.Header.Get("X-Message-Id")
+	log.Info("Email sent successfully", "messageID", messageID)
+	return messageID, nil
+}
+
+// Verify lists the account's domains, which checks the API token, and
+// checks that domain is among them and verified. The list is paged through
+// until domain turns up.
+func (p *mailerSendProvider) Verify(ctx context.Context, domain string) error {
+	ms := p.sdk()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for page := 1; ; page++ {
+		domains, _, err := ms.Domain.List(ctx, &mailersend.ListDomainOptions{Page: page, Limit: 100})
+		if err != nil {
+			return mailerSendError(err)
+		}
+		if domain == "" {
+			return nil
+		}
+		for _, d := range domains.Data {
+			if strings.EqualFold(d.Name, domain) {
+				if !d.IsVerified {
+					return fmt.Errorf("mailersend domain %s: %w", domain, errDomainNotVerified)
+				}
+				return nil
+			}
+		}
+		if domains.Links.Next == "" || len(domains.Data) == 0 {
+			return fmt.Errorf("%s is not a domain of the mailersend account: %w", domain, errDomainNotVerified)
+		}
+	}
+}
+
+// FindSent searches the last three days of activity on each of the
+// account's domains for an email tagged with key. The activity does not name
+// the message an email belongs to, so the id found is the email's.
+func (p *mailerSendProvider) FindSent(ctx context.Context, key string) (string, bool, error) {
+	ms := p.sdk()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tag := mailerSendAttemptTag + key
+	to := time.Now()
+	from := to.Add(-mailerSendFindWindow)
+	for page := 1; ; page++ {
+		domains, _, err := ms.Domain.List(ctx, &mailersend.ListDomainOptions{Page: page, Limit: 100})
+		if err != nil {
+			return "", false, mailerSendError(err)
+		}
+		for _, d := range domains.Data {
+			emailID, found, err := mailerSendFindTagged(ctx, ms, d.ID, tag, from, to)
+			if err != nil || found {
+				return emailID, found, err
+			}
+		}
+		if domains.Links.Next == "" || len(domains.Data) == 0 {
+			return "", false, nil
+		}
+	}
+}
+
+// mailerSendFindTagged pages through the activity of a domain between from
+// and to for an email tagged with tag.
+func mailerSendFindTagged(ctx context.Context, ms *mailersend.Mailersend, domainID, tag string, from, to time.Time) (string, bool, error) {
+	for page := 1; ; page++ {
+		activity, _, err := ms.Activity.List(ctx, &mailersend.ActivityOptions{
+			DomainID: domainID,
+			Page:     page,
+			Limit:    100,
+			DateFrom: from.Unix(),
+			DateTo:   to.Unix(),
+		})
+		if err != nil {
+			return "", false, mailerSendError(err)
+		}
+		for _, a := range activity.Data {
+			// The SDK leaves tags undecoded: a list of strings, or null.
+			tags, _ := a.Email.Tags.([]interface{})
+			for _, t := range tags {
+				if t == tag {
+					return a.Email.ID, true, nil
+				}
+			}
+		}
+		if activity.Links.Next == "" || len(activity.Data) == 0 {
+			return "", false, nil
+		}
+	}
+}
+
+// sdk returns a MailerSend client using the provider's HTTP client.
+func (p *mailerSendProvider) sdk() *mailersend.Mailersend {
+	ms := mailersend.NewMailersend(p.apiToken)
+	if p.client != nil {
+		ms.SetClient(p.client)
+	}
+	return ms
+}
+
+func mailerSendRecipients(addrs []Address) []mailersend.Recipient {
+	out := make([]mailersend.Recipient, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, mailersend.Recipient{Name: a.Name, Email: a.Email})
+	}
+	return out
+}
+
+// mailerSendError converts MailerSend API errors into *httpStatusError so
+// they are classified like every other provider's.
+func mailerSendError(err error) error {
+	var errRes *mailersend.ErrorResponse
+	if errors.As(err, &errRes) && errRes.Response != nil {
+		return &httpStatusError{
+			Provider:   string(emailv1.ProviderMailerSend),
+			StatusCode: errRes.Response.StatusCode,
+			Body:       errRes.Message,
+		}
+	}
+	var authErr *mailersend.AuthError
+	if errors.As(err, &authErr) && authErr.Response != nil {
+		return &httpStatusError{
+			Provider:   string(emailv1.ProviderMailerSend),
+			StatusCode: authErr.Response.StatusCode,
+			Body:       authErr.Message,
+		}
+	}
+	return err
+}
@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+const (
+	mailgunBaseURLUS = "https://api.mailgun.net/v3"
+	mailgunBaseURLEU = "https://api.eu.mailgun.net/v3"
+)
+
+const (
+	// mailgunAttemptVar is the user variable the idempotency key is sent as.
+	mailgunAttemptVar = "attempt-id"
+	// mailgunFindWindow is how far back FindSent searches the domain's
+	// events.
+	mailgunFindWindow = 72 * time.Hour
+)
+
+// mailgunEventsResponse is a page of the events of a domain.
+type mailgunEventsResponse struct {
+	Items []struct {
+		UserVariables map[string]interface{} `json:"user-variables"`
+		Message       struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+	} `json:"items"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+// mailgunProvider sends email through the Mailgun messages API.
+type mailgunProvider struct {
+	apiKey  string
+	domain  string
+	baseURL string
+	client  *http.Client
+}
+
+func newMailgunProvider(config ProviderConfig) (Provider, error) {
+	p := &mailgunProvider{
+		apiKey:  config.secretValue("api-token"),
+		baseURL: mailgunBaseURLUS,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if config.Spec.Mailgun != nil {
+		p.domain = config.Spec.Mailgun.Domain
+		if config.Spec.Mailgun.Region == emailv1.MailgunRegionEU {
+			p.baseURL = mailgunBaseURLEU
+		}
+	}
+	return p, nil
+}
+
+func (p *mailgunProvider) Name() string {
+	return string(emailv1.ProviderMailgun)
+}
+
+func (p *mailgunProvider) providerTemplates() {}
+
+func (p *mailgunProvider) requiresTo() {}
+
+// maxScheduleAhead is the three day limit Mailgun puts on o:deliverytime.
+func (p *mailgunProvider) maxScheduleAhead() time.Duration {
+	return 72 * time.Hour
+}
+
+func (p *mailgunProvider) Validate() error {
+	if p.apiKey == "" {
+		return errors.New("secret key api-token is empty")
+	}
+	if p.domain == "" {
+		return errors.New("spec.mailgun.domain is required")
+	}
+	return nil
+}
+
+func (p *mailgunProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	log := log.FromContext(ctx)
+
+	form := url.Values{}
+	form.Set("from", msg.From.String())
+	for _, to := range msg.To {
+		form.Add("to", to.String())
+	}
+	for _, cc := range msg.Cc {
+		form.Add("cc", cc.String())
+	}
+	for _, bcc := range msg.Bcc {
+		form.Add("bcc", bcc.String())
+	}
+	if msg.ReplyTo != nil {
+		form.Set("h:Reply-To", msg.ReplyTo.String())
+	}
+	for name, value := range msg.Headers {
+		form.Set("h:"+name, value)
+	}
+	if msg.IdempotencyKey != "" {
+		form.Set("v:"+mailgunAttemptVar, msg.IdempotencyKey)
+	}
+	if msg.Subject != "" || msg.Template == nil {
+		form.Set("subject", msg.Subject)
+	}
+	if msg.Text != "" {
+		form.Set("text", msg.Text)
+	}
+	if msg.HTML != "" {
+		form.Set("html", msg.HTML)
+	}
+	if !msg.SendAt.IsZero() {
+		form.Set("o:deliverytime", msg.SendAt.UTC().Format(time.RFC1123Z))
+	}
+	if msg.Template != nil {
+		if err := mailgunTemplate(form, msg); err != nil {
+			return "", err
+		}
+	}
+
+	var reqBody io.Reader = strings.NewReader(form.Encode())
+	contentType := "application/x-www-form-urlencoded"
+	if len(msg.Attachments) > 0 {
+		data, multipartType, err := mailgunMultipart(form, msg.Attachments)
+		if err != nil {
+			return "", err
+		}
+		reqBody, contentType = bytes.NewReader(data), multipartType
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/messages", p.baseURL, url.PathEscape(p.domain))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, reqBody)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth("api", p.apiKey)
+	req.Header.Set("Content-Type", contentType)
+
+	log.Info("Sending email with Mailgun", "domain", p.domain, "recipients", msg.Recipients(), "subject", msg.Subject)
+
+	_, body, err := doHTTP(p.client, p.Name(), req)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode mailgun response: %w", err)
+	}
+
+	log.Info("Email sent successfully", "messageID", result.ID)
+	return result.ID, nil
+}
+
+// FindSent searches the last three days of the domain's accepted events for
+// the message sent with key as a user variable. Mailgun reports message ids
+// without the angle brackets Send returns them in, so they are added back.
+func (p *mailgunProvider) FindSent(ctx context.Context, key string) (string, bool, error) {
+	query := url.Values{}
+	query.Set("event", "accepted")
+	query.Set("begin", time.Now().Add(-mailgunFindWindow).UTC().Format(time.RFC1123Z))
+	query.Set("ascending", "yes")
+	query.Set("limit", "300")
+	endpoint := fmt.Sprintf("%s/%s/events?%s", p.baseURL, url.PathEscape(p.domain), query.Encode())
+	for endpoint != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return "", false, err
+		}
+		req.SetBasicAuth("api", p.apiKey)
+
+		_, body, err := doHTTP(p.client, p.Name(), req)
+		if err != nil {
+			return "", false, err
+		}
+		var result mailgunEventsResponse
+		if err := json.Unmarshal(body, &result); err != nil {
+			return "", false, fmt.Errorf("failed to decode mailgun events response: %w", err)
+		}
+		for _, item := range result.Items {
+			if item.UserVariables[mailgunAttemptVar] == key {
+				return "<" + item.Message.Headers.MessageID + ">", true, nil
+			}
+		}
+		if len(result.Items) == 0 {
+			break
+		}
+		endpoint = result.Paging.Next
+	}
+	return "", false, nil
+}
+
+// Verify looks up the configured sending domain, which both checks the API
+// key and that Mailgun has verified the domain. Mailgun sends from its
+// configured domain whatever the sender address, so domain is not used.
+func (p *mailgunProvider) Verify(ctx context.Context, domain string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/domains/"+url.PathEscape(p.domain), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", p.apiKey)
+
+	_, body, err := doHTTP(p.client, p.Name(), req)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s is not a domain of the mailgun account: %w", p.domain, errDomainNotVerified)
+	}
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Domain struct {
+			State string `json:"state"`
+		} `json:"domain"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to decode mailgun domain response: %w", err)
+	}
+	if result.Domain.State != "active" {
+		return fmt.Errorf("mailgun domain %s is %s: %w", p.domain, result.Domain.State, errDomainNotVerified)
+	}
+	return nil
+}
+
+// mailgunTemplate adds a stored template and its variables to form.
+// Per-recipient variables are sent as recipient-variables, which makes
+// Mailgun send each To recipient a separate copy.
+func mailgunTemplate(form url.Values, msg *Message) error {
+	form.Set("template", msg.Template.ID)
+	if len(msg.Template.Variables) > 0 {
+		vars, err := json.Marshal(msg.Template.Variables)
+		if err != nil {
+			return fmt.Errorf("failed to encode template variables: %w", err)
+		}
+		form.Set("t:variables", string(vars))
+	}
+	if len(msg.Template.Personalization) > 0 {
+		perRecipient := make(map[string]map[string]interface{}, len(msg.To))
+		for _, to := range msg.To {
+			perRecipient[to.Email] = msg.Template.VariablesFor(to.Email)
+		}
+		vars, err := json.Marshal(perRecipient)
+		if err != nil {
+			return fmt.Errorf("failed to encode recipient variables: %w", err)
+		}
+		form.Set("recipient-variables", string(vars))
+	}
+	return nil
+}
+
+// mailgunMultipart encodes form and the attachments as multipart/form-data.
+// Mailgun names inline files by their content id, which the HTML body
+// references as cid:<name>.
+func mailgunMultipart(form url.Values, attachments []Attachment) ([]byte, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range form[k] {
+			if err := mw.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	for _, a := range attachments {
+		field, filename := "attachment", a.Filename
+		if a.Inline {
+			field, filename = "inline", a.ContentID
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": field, "filename": filename}))
+		h.Set("Content-Type", a.ContentType)
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := pw.Write(a.Data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mailgun provider", func() {
+	It("selects the API host from the region", func() {
+		p, err := DefaultProviders.New("Mailgun", ProviderConfig{
+			Spec: emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{
+				Mailgun: &emailv1.MailgunSpec{Domain: "mg.example.com", Region: emailv1.MailgunRegionEU},
+			}},
+			Secret: map[string][]byte{"api-token": []byte("key")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.(*mailgunProvider).baseURL).To(Equal(mailgunBaseURLEU))
+	})
+
+	It("requires a sending domain", func() {
+		_, err := DefaultProviders.New("Mailgun", ProviderConfig{
+			Secret: map[string][]byte{"api-token": []byte("key")},
+		})
+		Expect(err).To(MatchError(ContainSubstring("spec.mailgun.domain is required")))
+	})
+
+	It("posts the message to the domain's messages endpoint", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/v3/mg.example.com/messages"))
+			user, pass, ok := r.BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(user).To(Equal("api"))
+			Expect(pass).To(Equal("key"))
+			Expect(r.ParseForm()).To(Succeed())
+			Expect(r.PostForm.Get("from")).To(Equal("sender@example.com"))
+			Expect(r.PostForm["to"]).To(Equal([]string{"recipient@example.com"}))
+			Expect(r.PostForm["cc"]).To(Equal([]string{"oncall@example.com"}))
+			Expect(r.PostForm["bcc"]).To(Equal([]string{"audit@example.com"}))
+			Expect(r.PostForm.Get("subject")).To(Equal("Hello"))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"<123@mg.example.com>","message":"Queued. Thank you."}`))
+		}))
+		defer server.Close()
+
+		p := &mailgunProvider{apiKey: "key", domain: "mg.example.com", baseURL: server.URL + "/v3", client: server.Client()}
+		id, err := p.Send(context.Background(), &Message{
+			From:    Address{Email: "sender@example.com"},
+			To:      []Address{{Email: "recipient@example.com"}},
+			Cc:      []Address{{Email: "oncall@example.com"}},
+			Bcc:     []Address{{Email: "audit@example.com"}},
+			Subject: "Hello",
+			Text:    "World",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("<123@mg.example.com>"))
+	})
+
+	It("reports API errors", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message":"Forbidden"}`, http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		p := &mailgunProvider{apiKey: "key", domain: "mg.example.com", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), &Message{From: Address{Email: "sender@example.com"}})
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+})
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+const postmarkBaseURL = "https://api.postmarkapp.com"
+
+// postmarkProvider sends email through the Postmark email API.
+type postmarkProvider struct {
+	serverToken   string
+	messageStream string
+	baseURL       string
+	client        *http.Client
+}
+
+type postmarkAttachment struct {
+	Name        string `json:"Name"`
+	Content     string `json:"Content"`
+	ContentType string `json:"ContentType"`
+	ContentID   string `json:"ContentID,omitempty"`
+}
+
+type postmarkHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type postmarkMessage struct {
+	From          string            `json:"From"`
+	To            string            `json:"To"`
+	Cc            string            `json:"Cc,omitempty"`
+	Bcc           string            `json:"Bcc,omitempty"`
+	ReplyTo       string            `json:"ReplyTo,omitempty"`
+	Headers       []postmarkHeader  `json:"Headers,omitempty"`
+	Subject       string            `json:"Subject"`
+	TextBody      string            `json:"TextBody,omitempty"`
+	HtmlBody      string            `json:"HtmlBody,omitempty"`
+	MessageStream string            `json:"MessageStream,omitempty"`
+	Metadata      map[string]string `json:"Metadata,omitempty"`
+
+	Attachments []postmarkAttachment `json:"Attachments,omitempty"`
+}
+
+// postmarkTemplateMessage is the body of a send with a stored template,
+// which supplies the subject and bodies.
+type postmarkTemplateMessage struct {
+	From          string            `json:"From"`
+	To            string            `json:"To"`
+	Cc            string            `json:"Cc,omitempty"`
+	Bcc           string            `json:"Bcc,omitempty"`
+	ReplyTo       string            `json:"ReplyTo,omitempty"`
+	Headers       []postmarkHeader  `json:"Headers,omitempty"`
+	MessageStream string            `json:"MessageStream,omitempty"`
+	Metadata      map[string]string `json:"Metadata,omitempty"`
+
+	TemplateID    int64                  `json:"TemplateId,omitempty"`
+	TemplateAlias string                 `json:"TemplateAlias,omitempty"`
+	TemplateModel map[string]interface{} `json:"TemplateModel"`
+
+	Attachments []postmarkAttachment `json:"Attachments,omitempty"`
+}
+
+// postmarkAttemptKey is the metadata key the idempotency key is sent under.
+const postmarkAttemptKey = "attempt_id"
+
+// postmarkSearchResponse is a page of an outbound message search.
+type postmarkSearchResponse struct {
+	TotalCount int `json:"TotalCount"`
+	Messages   []struct {
+		MessageID string `json:"MessageID"`
+	} `json:"Messages"`
+}
+
+type postmarkResponse struct {
+	To          string `json:"To"`
+	SubmittedAt string `json:"SubmittedAt"`
+	MessageID   string `json:"MessageID"`
+	ErrorCode   int    `json:"ErrorCode"`
+	Message     string `json:"Message"`
+}
+
+func newPostmarkProvider(config ProviderConfig) (Provider, error) {
+	p := &postmarkProvider{
+		serverToken: config.secretValue("api-token"),
+		baseURL:     postmarkBaseURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if config.Spec.Postmark != nil {
+		p.messageStream = config.Spec.Postmark.MessageStream
+	}
+	return p, nil
+}
+
+func (p *postmarkProvider) Name() string {
+	return string(emailv1.ProviderPostmark)
+}
+
+func (p *postmarkProvider) providerTemplates() {}
+
+func (p *postmarkProvider) requiresTo() {}
+
+func (p *postmarkProvider) Validate() error {
+	if p.serverToken == "" {
+		return errors.New("secret key api-token is empty")
+	}
+	return nil
+}
+
+func (p *postmarkProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	log := log.FromContext(ctx)
+
+	payload := postmarkMessage{
+		From:          msg.From.String(),
+		To:            joinAddresses(msg.To),
+		Cc:            joinAddresses(msg.Cc),
+		Bcc:           joinAddresses(msg.Bcc),
+		Subject:       msg.Subject,
+		TextBody:      msg.Text,
+		HtmlBody:      msg.HTML,
+		MessageStream: p.messageStream,
+	}
+	if msg.IdempotencyKey != "" {
+		payload.Metadata = map[string]string{postmarkAttemptKey: msg.IdempotencyKey}
+	}
+	if msg.ReplyTo != nil {
+		payload.ReplyTo = msg.ReplyTo.String()
+	}
+	for _, name := range sortedHeaderNames(msg.Headers) {
+		payload.Headers = append(payload.Headers, postmarkHeader{Name: name, Value: msg.Headers[name]})
+	}
+	for _, a := range msg.Attachments {
+		attachment := postmarkAttachment{
+			Name:        a.Filename,
+			Content:     base64.StdEncoding.EncodeToString(a.Data),
+			ContentType: a.ContentType,
+		}
+		if a.Inline {
+			attachment.ContentID = "cid:" + a.ContentID
+		}
+		payload.Attachments = append(payload.Attachments, attachment)
+	}
+
+	var request interface{} = payload
+	endpoint := p.baseURL + "/email"
+	if msg.Template != nil {
+		var err error
+		if request, err = postmarkTemplate(payload, msg); err != nil {
+			return "", err
+		}
+		endpoint = p.baseURL + "/email/withTemplate"
+	}
+
+	log.Info("Sending email with Postmark", "recipients", msg.Recipients(), "subject", msg.Subject)
+
+	_, body, err := postJSON(ctx, p.client, p.Name(), endpoint, map[string]string{
+		"X-Postmark-Server-Token": p.serverToken,
+	}, request)
+	if err != nil {
+		return "", err
+	}
+
+	var result postmarkResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode postmark response: %w", err)
+	}
+	// Postmark reports some rejections with a 200 and a non-zero ErrorCode.
+	if result.ErrorCode != 0 {
+		return "", fmt.Errorf("postmark error %d: %s", result.ErrorCode, result.Message)
+	}
+
+	log.Info("Email sent successfully", "messageID", result.MessageID)
+	return result.MessageID, nil
+}
+
+// FindSent searches the outbound messages for the one sent with key in its
+// metadata.
+func (p *postmarkProvider) FindSent(ctx context.Context, key string) (string, bool, error) {
+	query := url.Values{}
+	query.Set("count", "1")
+	query.Set("offset", "0")
+	query.Set("metadata_"+postmarkAttemptKey, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/messages/outbound?"+query.Encode(), nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", p.serverToken)
+
+	_, body, err := doHTTP(p.client, p.Name(), req)
+	if err != nil {
+		return "", false, err
+	}
+	var result postmarkSearchResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", false, fmt.Errorf("failed to decode postmark search response: %w", err)
+	}
+	if len(result.Messages) == 0 {
+		return "", false, nil
+	}
+	return result.Messages[0].MessageID, true, nil
+}
+
+// postmarkTemplate converts payload into a send with a stored template, by
+// id when the template id is numeric and by alias otherwise. Postmark renders
+// one model per message, so per-recipient variables need a single recipient.
+func postmarkTemplate(payload postmarkMessage, msg *Message) (*postmarkTemplateMessage, error) {
+	recipients := msg.Recipients()
+	if len(msg.Template.Personalization) > 0 && len(recipients) != 1 {
+		return nil, errors.New("postmark only supports providerTemplate.personalization for emails with a single recipient")
+	}
+	var to string
+	if len(recipients) == 1 {
+		to = recipients[0].Email
+	}
+
+	out := &postmarkTemplateMessage{
+		From:          payload.From,
+		To:            payload.To,
+		Cc:            payload.Cc,
+		Bcc:           payload.Bcc,
+		ReplyTo:       payload.ReplyTo,
+		Headers:       payload.Headers,
+		MessageStream: payload.MessageStream,
+		Metadata:      payload.Metadata,
+		TemplateModel: msg.Template.VariablesFor(to),
+		Attachments:   payload.Attachments,
+	}
+	if id, err := strconv.ParseInt(msg.Template.ID, 10, 64); err == nil {
+		out.TemplateID = id
+	} else {
+		out.TemplateAlias = msg.Template.ID
+	}
+	return out, nil
+}
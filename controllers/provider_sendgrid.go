@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+const sendGridBaseURL = "https://api.sendgrid.com/v3"
+
+// sendGridProvider sends email through the SendGrid v3 mail send API.
+type sendGridProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To                  []sendGridAddress      `json:"to"`
+	Cc                  []sendGridAddress      `json:"cc,omitempty"`
+	Bcc                 []sendGridAddress      `json:"bcc,omitempty"`
+	DynamicTemplateData map[string]interface{} `json:"dynamic_template_data,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type,omitempty"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type sendGridMessage struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	TemplateID       string                    `json:"template_id,omitempty"`
+	SendAt           int64                     `json:"send_at,omitempty"`
+	CustomArgs       map[string]string         `json:"custom_args,omitempty"`
+	Content          []sendGridContent         `json:"content,omitempty"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+}
+
+// sendGridAttemptArg is the custom arg the idempotency key is sent as.
+const sendGridAttemptArg = "attempt_id"
+
+// sendGridActivityResponse is a page of an Email Activity search.
+type sendGridActivityResponse struct {
+	Messages []struct {
+		MsgID string `json:"msg_id"`
+	} `json:"messages"`
+}
+
+func newSendGridProvider(config ProviderConfig) (Provider, error) {
+	return &sendGridProvider{
+		apiKey:  config.secretValue("api-token"),
+		baseURL: sendGridBaseURL,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *sendGridProvider) Name() string {
+	return string(emailv1.ProviderSendGrid)
+}
+
+func (p *sendGridProvider) providerTemplates() {}
+
+func (p *sendGridProvider) requiresTo() {}
+
+// maxScheduleAhead is the 72 hour limit SendGrid puts on send_at.
+func (p *sendGridProvider) maxScheduleAhead() time.Duration {
+	return 72 * time.Hour
+}
+
+func (p *sendGridProvider) Validate() error {
+	if p.apiKey == "" {
+		return errors.New("secret key api-token is empty")
+	}
+	return nil
+}
+
+func (p *sendGridProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	log := log.FromContext(ctx)
+
+	payload := sendGridMessage{
+		Personalizations: sendGridPersonalizations(msg),
+		From:             sendGridAddress{Email: msg.From.Email, Name: msg.From.Name},
+		Subject:          msg.Subject,
+		Headers:          msg.Headers,
+	}
+	if msg.ReplyTo != nil {
+		payload.ReplyTo = &sendGridAddress{Email: msg.ReplyTo.Email, Name: msg.ReplyTo.Name}
+	}
+	if msg.Template != nil {
+		payload.TemplateID = msg.Template.ID
+	}
+	if !msg.SendAt.IsZero() {
+		payload.SendAt = msg.SendAt.Unix()
+	}
+	if msg.IdempotencyKey != "" {
+		payload.CustomArgs = map[string]string{sendGridAttemptArg: msg.IdempotencyKey}
+	}
+	// SendGrid requires text/plain to come before text/html.
+	if msg.Text != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/plain", Value: msg.Text})
+	}
+	if msg.HTML != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/html", Value: msg.HTML})
+	}
+	for _, a := range msg.Attachments {
+		attachment := sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Data),
+			Type:        a.ContentType,
+			Filename:    a.Filename,
+			Disposition: "attachment",
+		}
+		if a.Inline {
+			attachment.Disposition = "inline"
+			attachment.ContentID = a.ContentID
+		}
+		payload.Attachments = append(payload.Attachments, attachment)
+	}
+
+	log.Info("Sending email with SendGrid", "recipients", msg.Recipients(), "subject", msg.Subject)
+
+	res, _, err := postJSON(ctx, p.client, p.Name(), p.baseURL+"/mail/send", map[string]string{
+		"Authorization": "Bearer " + p.apiKey,
+	}, payload)
+	if err != nil {
+		return "", err
+	}
+
+	messageID := res.Header.Get("X-Message-Id")
+	log.Info("Email sent successfully", "messageID", messageID)
+	return messageID, nil
+}
+
+// FindSent searches the Email Activity feed for the message sent with key as
+// its custom arg. The feed needs SendGrid's Email Activity add-on, and
+// messages show up in it after a short delay.
+func (p *sendGridProvider) FindSent(ctx context.Context, key string) (string, bool, error) {
+	query := url.Values{}
+	query.Set("limit", "1")
+	query.Set("query", fmt.Sprintf("unique_args['%s']=%q", sendGridAttemptArg, key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/messages?"+query.Encode(), nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	_, body, err := doHTTP(p.client, p.Name(), req)
+	if err != nil {
+		return "", false, err
+	}
+	var result sendGridActivityResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", false, fmt.Errorf("failed to decode sendgrid activity response: %w", err)
+	}
+	if len(result.Messages) == 0 {
+		return "", false, nil
+	}
+	return result.Messages[0].MsgID, true, nil
+}
+
+// Verify checks that the API key is accepted and may send mail. SendGrid
+// also sends from single verified senders, so domain is not checked.
+func (p *sendGridProvider) Verify(ctx context.Context, domain string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/scopes", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	_, body, err := doHTTP(p.client, p.Name(), req)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to decode sendgrid scopes response: %w", err)
+	}
+	for _, scope := range result.Scopes {
+		if scope == "mail.send" {
+			return nil
+		}
+	}
+	return &httpStatusError{Provider: p.Name(), StatusCode: http.StatusForbidden, Body: "API key lacks the mail.send scope"}
+}
+
+// sendGridPersonalizations addresses msg in a single personalization. A
+// template with per-recipient variables gets one personalization, and so one
+// copy of the email, per To recipient; Cc and Bcc go with the first.
+func sendGridPersonalizations(msg *Message) []sendGridPersonalization {
+	first := sendGridPersonalization{
+		To:  sendGridAddresses(msg.To),
+		Cc:  sendGridAddresses(msg.Cc),
+		Bcc: sendGridAddresses(msg.Bcc),
+	}
+	if msg.Template == nil {
+		return []sendGridPersonalization{first}
+	}
+	if len(msg.Template.Personalization) == 0 || len(msg.To) < 2 {
+		var to string
+		if len(msg.To) == 1 {
+			to = msg.To[0].Email
+		}
+		first.DynamicTemplateData = msg.Template.VariablesFor(to)
+		return []sendGridPersonalization{first}
+	}
+
+	out := make([]sendGridPersonalization, 0, len(msg.To))
+	for i, to := range msg.To {
+		p := sendGridPersonalization{
+			To:                  sendGridAddresses([]Address{to}),
+			DynamicTemplateData: msg.Template.VariablesFor(to.Email),
+		}
+		if i == 0 {
+			p.Cc, p.Bcc = first.Cc, first.Bcc
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func sendGridAddresses(addrs []Address) []sendGridAddress {
+	if len(addrs) == 0 {
+		return nil
+	}
+	out := make([]sendGridAddress, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, sendGridAddress{Email: a.Email, Name: a.Name})
+	}
+	return out
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// sesThrottlingErrors are the SES error types that mean "slow down and retry".
+var sesThrottlingErrors = []string{
+	"TooManyRequestsException",
+	"LimitExceededException",
+	"ThrottlingException",
+}
+
+// sesProvider sends email through the Amazon SES v2 SendEmail API.
+type sesProvider struct {
+	creds            awsCredentials
+	region           string
+	endpoint         string
+	configurationSet string
+	client           *http.Client
+}
+
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset,omitempty"`
+}
+
+type sesBody struct {
+	Text *sesContent `json:"Text,omitempty"`
+	Html *sesContent `json:"Html,omitempty"`
+}
+
+type sesHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type sesSimpleMessage struct {
+	Subject sesContent  `json:"Subject"`
+	Body    sesBody     `json:"Body"`
+	Headers []sesHeader `json:"Headers,omitempty"`
+}
+
+// sesRawMessage carries a complete MIME message, used for attachments.
+type sesRawMessage struct {
+	Data []byte `json:"Data"`
+}
+
+type sesSendEmailRequest struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses  []string `json:"ToAddresses"`
+		CcAddresses  []string `json:"CcAddresses,omitempty"`
+		BccAddresses []string `json:"BccAddresses,omitempty"`
+	} `json:"Destination"`
+	Content struct {
+		Simple *sesSimpleMessage `json:"Simple,omitempty"`
+		Raw    *sesRawMessage    `json:"Raw,omitempty"`
+	} `json:"Content"`
+	ReplyToAddresses     []string `json:"ReplyToAddresses,omitempty"`
+	ConfigurationSetName string   `json:"ConfigurationSetName,omitempty"`
+}
+
+func newSESProvider(config ProviderConfig) (Provider, error) {
+	p := &sesProvider{
+		creds: awsCredentials{
+			AccessKeyID:     config.secretValue("access-key-id"),
+			SecretAccessKey: config.secretValue("secret-access-key"),
+			SessionToken:    config.secretValue("session-token"),
+		},
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if spec := config.Spec.SES; spec != nil {
+		p.region = spec.Region
+		p.endpoint = strings.TrimSuffix(spec.Endpoint, "/")
+		p.configurationSet = spec.ConfigurationSetName
+	}
+	if p.endpoint == "" && p.region != "" {
+		p.endpoint = fmt.Sprintf("https://email.%s.amazonaws.com", p.region)
+	}
+	return p, nil
+}
+
+func (p *sesProvider) Name() string {
+	return string(emailv1.ProviderSES)
+}
+
+func (p *sesProvider) Validate() error {
+	if p.creds.AccessKeyID == "" || p.creds.SecretAccessKey == "" {
+		return errors.New("secret keys access-key-id and secret-access-key are required")
+	}
+	if p.region == "" {
+		return errors.New("spec.ses.region is required")
+	}
+	return nil
+}
+
+func (p *sesProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	log := log.FromContext(ctx)
+
+	var payload sesSendEmailRequest
+	payload.FromEmailAddress = msg.From.String()
+	for _, to := range msg.To {
+		payload.Destination.ToAddresses = append(payload.Destination.ToAddresses, to.String())
+	}
+	for _, cc := range msg.Cc {
+		payload.Destination.CcAddresses = append(payload.Destination.CcAddresses, cc.String())
+	}
+	for _, bcc := range msg.Bcc {
+		payload.Destination.BccAddresses = append(payload.Destination.BccAddresses, bcc.String())
+	}
+	if len(msg.Attachments) > 0 {
+		// Simple content cannot carry attachments, so send the MIME message.
+		raw, err := buildMIME(msg, messageIDFor(msg), time.Now())
+		if err != nil {
+			return "", err
+		}
+		payload.Content.Raw = &sesRawMessage{Data: raw}
+	} else {
+		simple := &sesSimpleMessage{Subject: sesContent{Data: msg.Subject, Charset: "UTF-8"}}
+		if msg.Text != "" {
+			simple.Body.Text = &sesContent{Data: msg.Text, Charset: "UTF-8"}
+		}
+		if msg.HTML != "" {
+			simple.Body.Html = &sesContent{Data: msg.HTML, Charset: "UTF-8"}
+		}
+		for _, name := range sortedHeaderNames(msg.Headers) {
+			simple.Headers = append(simple.Headers, sesHeader{Name: name, Value: msg.Headers[name]})
+		}
+		payload.Content.Simple = simple
+	}
+	if msg.ReplyTo != nil {
+		payload.ReplyToAddresses = []string{msg.ReplyTo.String()}
+	}
+	payload.ConfigurationSetName = p.configurationSet
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/v2/email/outbound-emails", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signV4(req, data, p.creds, p.region, "ses", time.Now())
+
+	log.Info("Sending email with SES", "region", p.region, "recipients", msg.Recipients(), "subject", msg.Subject)
+
+	res, body, err := doHTTP(p.client, p.Name(), req)
+	if err != nil {
+		if isSESThrottling(res, err) {
+			return "", &RetryableError{Err: err}
+		}
+		return "", err
+	}
+
+	var result struct {
+		MessageId string `json:"MessageId"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode SES response: %w", err)
+	}
+
+	log.Info("Email sent successfully", "messageID", result.MessageId)
+	return result.MessageId, nil
+}
+
+// isSESThrottling reports whether an SES error response is a throttling error.
+func isSESThrottling(res *http.Response, err error) bool {
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	if statusErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	errorType := res.Header.Get("X-Amzn-ErrorType")
+	for _, t := range sesThrottlingErrors {
+		if strings.HasPrefix(errorType, t) || strings.Contains(statusErr.Body, t) {
+			return true
+		}
+	}
+	return false
+}
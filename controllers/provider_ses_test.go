@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SigV4 signing", func() {
+	It("matches the AWS get-vanilla test vector", func() {
+		req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+		Expect(err).NotTo(HaveOccurred())
+		now, err := time.Parse(sigV4TimeFormat, "20150830T123600Z")
+		Expect(err).NotTo(HaveOccurred())
+
+		signV4(req, nil, awsCredentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		}, "us-east-1", "service", now)
+
+		Expect(req.Header.Get("Authorization")).To(Equal(
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"))
+	})
+})
+
+var _ = Describe("SES provider", func() {
+	newProvider := func(endpoint string) Provider {
+		p, err := DefaultProviders.New("SES", ProviderConfig{
+			Spec: emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{
+				SES: &emailv1.SESSpec{Region: "eu-west-1", Endpoint: endpoint},
+			}},
+			Secret: map[string][]byte{
+				"access-key-id":     []byte("AKID"),
+				"secret-access-key": []byte("secret"),
+				"session-token":     []byte("session"),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	It("defaults the endpoint from the region", func() {
+		p, err := newSESProvider(ProviderConfig{Spec: emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{
+			SES: &emailv1.SESSpec{Region: "eu-west-1"},
+		}}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.(*sesProvider).endpoint).To(Equal("https://email.eu-west-1.amazonaws.com"))
+	})
+
+	It("sends a signed SendEmail request and returns the MessageId", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/v2/email/outbound-emails"))
+			Expect(r.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256 Credential=AKID/"))
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/eu-west-1/ses/aws4_request"))
+			Expect(r.Header.Get("X-Amz-Security-Token")).To(Equal("session"))
+
+			var body sesSendEmailRequest
+			decodeJSON(r, &body)
+			Expect(body.FromEmailAddress).To(Equal(`"Operator" <sender@example.com>`))
+			Expect(body.Destination.ToAddresses).To(Equal([]string{`"Recipient" <recipient@example.com>`}))
+			Expect(body.Destination.CcAddresses).To(Equal([]string{`"On-call" <oncall@example.com>`}))
+			Expect(body.Destination.BccAddresses).To(Equal([]string{"audit@example.com"}))
+			Expect(body.Content.Simple.Subject.Data).To(Equal("Hello"))
+			Expect(body.Content.Simple.Body.Html.Data).To(Equal("<p>World</p>"))
+
+			_, _ = w.Write([]byte(`{"MessageId":"ses-123"}`))
+		}))
+		defer server.Close()
+
+		id, err := newProvider(server.URL).Send(context.Background(), contractMessage())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("ses-123"))
+	})
+
+	It("marks throttling errors as retryable", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Amzn-ErrorType", "TooManyRequestsException")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"message":"Maximum sending rate exceeded."}`))
+		}))
+		defer server.Close()
+
+		_, err := newProvider(server.URL).Send(context.Background(), contractMessage())
+		Expect(err).To(HaveOccurred())
+		Expect(asRetryable(err)).NotTo(BeNil())
+	})
+
+	It("does not retry rejected messages", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Amzn-ErrorType", "MessageRejected")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"Email address is not verified."}`))
+		}))
+		defer server.Close()
+
+		_, err := newProvider(server.URL).Send(context.Background(), contractMessage())
+		Expect(err).To(MatchError(ContainSubstring("not verified")))
+		Expect(asRetryable(err)).To(BeNil())
+		Expect(strings.Contains(err.Error(), "400")).To(BeTrue())
+	})
+})
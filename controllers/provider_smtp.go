@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+const (
+	defaultSMTPConnectTimeout = 10 * time.Second
+	defaultSMTPTimeout        = 30 * time.Second
+)
+
+// smtpProvider sends email to an SMTP relay.
+type smtpProvider struct {
+	host           string
+	port           int
+	tlsMode        emailv1.SMTPTLSMode
+	auth           emailv1.SMTPAuthMechanism
+	username       string
+	password       string
+	tlsConfig      *tls.Config
+	connectTimeout time.Duration
+	timeout        time.Duration
+}
+
+func newSMTPProvider(config ProviderConfig) (Provider, error) {
+	spec := config.Spec.SMTP
+	if spec == nil {
+		return nil, errors.New("spec.smtp is required")
+	}
+
+	p := &smtpProvider{
+		host:           spec.Host,
+		port:           int(spec.Port),
+		tlsMode:        spec.TLSMode,
+		auth:           spec.Auth,
+		username:       config.secretValue("username"),
+		password:       config.secretValue("password"),
+		connectTimeout: defaultSMTPConnectTimeout,
+		timeout:        defaultSMTPTimeout,
+	}
+	if p.tlsMode == "" {
+		p.tlsMode = emailv1.SMTPTLSStartTLS
+	}
+	if p.port == 0 {
+		p.port = 587
+		if p.tlsMode == emailv1.SMTPTLSImplicit {
+			p.port = 465
+		}
+	}
+	if p.auth == "" {
+		p.auth = emailv1.SMTPAuthNone
+		if p.username != "" {
+			p.auth = emailv1.SMTPAuthPlain
+		}
+	}
+	if spec.ConnectTimeout != nil {
+		p.connectTimeout = spec.ConnectTimeout.Duration
+	}
+	if spec.Timeout != nil {
+		p.timeout = spec.Timeout.Duration
+	}
+	p.tlsConfig = &tls.Config{
+		ServerName:         spec.Host,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	}
+	return p, nil
+}
+
+func (p *smtpProvider) Name() string {
+	return string(emailv1.ProviderSMTP)
+}
+
+func (p *smtpProvider) Validate() error {
+	if p.host == "" {
+		return errors.New("spec.smtp.host is required")
+	}
+	if p.auth != emailv1.SMTPAuthNone && p.username == "" {
+		return fmt.Errorf("secret key username is required for %s auth", p.auth)
+	}
+	return nil
+}
+
+func (p *smtpProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	messageID, _, err := p.SendReportingRecipients(ctx, msg)
+	return messageID, err
+}
+
+// SendReportingRecipients sends msg and reports the server's reply to each
+// RCPT TO. The message is delivered to the accepted recipients as long as
+// there is at least one.
+func (p *smtpProvider) SendReportingRecipients(ctx context.Context, msg *Message) (string, []RecipientResult, error) {
+	log := log.FromContext(ctx)
+
+	messageID := messageIDFor(msg)
+	data, err := buildMIME(msg, messageID, time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+
+	c, err := p.dial(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer c.Close()
+
+	log.Info("Sending email with SMTP", "host", p.host, "port", p.port, "recipients", msg.Recipients(), "subject", msg.Subject)
+
+	if err := c.Mail(msg.From.Email); err != nil {
+		return "", nil, fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	var results []RecipientResult
+	var accepted int
+	var rcptErr error
+	for _, rcpt := range msg.Recipients() {
+		err := c.Rcpt(rcpt.Email)
+		if err != nil {
+			err = fmt.Errorf("RCPT TO %s rejected: %w", rcpt.Email, err)
+			rcptErr = err
+		} else {
+			accepted++
+		}
+		results = append(results, RecipientResult{Email: rcpt.Email, Err: err})
+	}
+	if accepted == 0 {
+		return "", results, rcptErr
+	}
+	w, err := c.Data()
+	if err != nil {
+		return "", nil, fmt.Errorf("DATA rejected: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", nil, err
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, fmt.Errorf("message rejected: %w", err)
+	}
+	if err := c.Quit(); err != nil {
+		log.Error(err, "Failed to close SMTP session cleanly")
+	}
+
+	log.Info("Email sent successfully", "messageID", messageID, "accepted", accepted, "rejected", len(results)-accepted)
+	return messageID, results, nil
+}
+
+// dial connects, secures and authenticates an SMTP session.
+func (p *smtpProvider) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(p.host, strconv.Itoa(p.port))
+	dialer := &net.Dialer{Timeout: p.connectTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(p.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if p.tlsMode == emailv1.SMTPTLSImplicit {
+		tlsConn := tls.Client(conn, p.tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	c, err := smtp.NewClient(conn, p.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if p.tlsMode == emailv1.SMTPTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(p.tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if auth := p.smtpAuth(); auth != nil {
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (p *smtpProvider) smtpAuth() smtp.Auth {
+	switch p.auth {
+	case emailv1.SMTPAuthPlain:
+		return smtp.PlainAuth("", p.username, p.password, p.host)
+	case emailv1.SMTPAuthLogin:
+		return &loginAuth{username: p.username, password: p.password}
+	case emailv1.SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(p.username, p.password)
+	default:
+		return nil
+	}
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp does not provide.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like smtp.PlainAuth, refuse to send credentials in the clear to a remote host.
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:", "User Name\x00":
+		return []byte(a.username), nil
+	case "Password:", "Password\x00":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
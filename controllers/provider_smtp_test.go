@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// smtpStandIn is a minimal in-process SMTP server that records what it receives.
+type smtpStandIn struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	implicit  bool
+
+	mu       sync.Mutex
+	username string
+	password string
+	from     string
+	rcpts    []string
+	reject   map[string]bool
+	data     string
+	tls      bool
+}
+
+func newSMTPStandIn(mode emailv1.SMTPTLSMode) *smtpStandIn {
+	// Borrow httptest's self-signed certificate for TLS.
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	tlsConfig := &tls.Config{Certificates: ts.TLS.Certificates}
+	ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	s := &smtpStandIn{listener: l}
+	switch mode {
+	case emailv1.SMTPTLSStartTLS:
+		s.tlsConfig = tlsConfig
+	case emailv1.SMTPTLSImplicit:
+		s.tlsConfig = tlsConfig
+		s.implicit = true
+	}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) port() int32 {
+	return int32(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *smtpStandIn) Close() {
+	s.listener.Close()
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	if s.implicit {
+		conn = tls.Server(conn, s.tlsConfig)
+		s.setTLS()
+	}
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	readLine := func() string {
+		line, _ := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n")
+	}
+	decode := func(v string) string {
+		b, _ := base64.StdEncoding.DecodeString(v)
+		return string(b)
+	}
+
+	reply("220 stand-in ESMTP")
+	for {
+		line := readLine()
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-stand-in")
+			if s.tlsConfig != nil && !s.implicit {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			reply("220 Ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			r = bufio.NewReader(conn)
+			s.setTLS()
+		case "AUTH":
+			args := strings.Fields(line)
+			s.mu.Lock()
+			switch strings.ToUpper(args[1]) {
+			case "PLAIN":
+				parts := strings.Split(decode(args[2]), "\x00")
+				s.username, s.password = parts[1], parts[2]
+			case "LOGIN":
+				s.mu.Unlock()
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+				username := decode(readLine())
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+				password := decode(readLine())
+				s.mu.Lock()
+				s.username, s.password = username, password
+			}
+			s.mu.Unlock()
+			reply("235 Authentication successful")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>")
+			s.mu.Lock()
+			rejected := s.reject[rcpt]
+			if !rejected {
+				s.rcpts = append(s.rcpts, rcpt)
+			}
+			s.mu.Unlock()
+			if rejected {
+				reply("550 No such user")
+				continue
+			}
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l := readLine()
+				if l == "." {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, ".") + "\r\n")
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		case "":
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) setTLS() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tls = true
+}
+
+var _ = Describe("SMTP provider", func() {
+	var msg *Message
+
+	BeforeEach(func() {
+		msg = &Message{
+			From:    Address{Name: "Operator", Email: "sender@example.com"},
+			To:      []Address{{Email: "one@example.com"}, {Email: "two@example.com"}},
+			Subject: "Héllo",
+			HTML:    "<p>World</p>",
+			Text:    "World",
+		}
+	})
+
+	newProvider := func(server *smtpStandIn, spec emailv1.SMTPSpec, secret map[string][]byte) Provider {
+		spec.Host = "127.0.0.1"
+		spec.Port = server.port()
+		spec.InsecureSkipVerify = true
+		p, err := DefaultProviders.New("SMTP", ProviderConfig{
+			Spec:   emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{SMTP: &spec}},
+			Secret: secret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	send := func(server *smtpStandIn, spec emailv1.SMTPSpec, secret map[string][]byte) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return newProvider(server, spec, secret).Send(ctx, msg)
+	}
+
+	It("delivers an RFC 5322 multipart message without TLS", func() {
+		server := newSMTPStandIn(emailv1.SMTPTLSNone)
+		defer server.Close()
+
+		id, err := send(server, emailv1.SMTPSpec{TLSMode: emailv1.SMTPTLSNone}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.from).To(Equal("sender@example.com"))
+		Expect(server.rcpts).To(Equal([]string{"one@example.com", "two@example.com"}))
+
+		parsed, err := mail.ReadMessage(strings.NewReader(server.data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Header.Get("Message-ID")).To(Equal(id))
+		Expect(parsed.Header.Get("From")).To(Equal(`"Operator" <sender@example.com>`))
+		Expect(parsed.Header.Get("To")).To(Equal("one@example.com, two@example.com"))
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(subject).To(Equal("Héllo"))
+		Expect(parsed.Header.Get("Content-Type")).To(HavePrefix("multipart/alternative"))
+	})
+
+	It("upgrades with STARTTLS and authenticates with PLAIN", func() {
+		server := newSMTPStandIn(emailv1.SMTPTLSStartTLS)
+		defer server.Close()
+
+		_, err := send(server, emailv1.SMTPSpec{}, map[string][]byte{
+			"username": []byte("user"),
+			"password": []byte("pass"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.tls).To(BeTrue())
+		Expect(server.username).To(Equal("user"))
+		Expect(server.password).To(Equal("pass"))
+	})
+
+	It("uses implicit TLS and authenticates with LOGIN", func() {
+		server := newSMTPStandIn(emailv1.SMTPTLSImplicit)
+		defer server.Close()
+
+		_, err := send(server, emailv1.SMTPSpec{
+			TLSMode: emailv1.SMTPTLSImplicit,
+			Auth:    emailv1.SMTPAuthLogin,
+		}, map[string][]byte{
+			"username": []byte("user"),
+			"password": []byte("pass"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.tls).To(BeTrue())
+		Expect(server.username).To(Equal("user"))
+		Expect(server.password).To(Equal("pass"))
+	})
+
+	It("refuses STARTTLS mode against a server that does not offer it", func() {
+		server := newSMTPStandIn(emailv1.SMTPTLSNone)
+		defer server.Close()
+
+		_, err := send(server, emailv1.SMTPSpec{}, nil)
+		Expect(err).To(MatchError(ContainSubstring("does not support STARTTLS")))
+	})
+
+	It("sends Cc in the headers and Bcc only in the envelope", func() {
+		server := newSMTPStandIn(emailv1.SMTPTLSNone)
+		defer server.Close()
+		msg.Cc = []Address{{Email: "oncall@example.com"}}
+		msg.Bcc = []Address{{Email: "audit@example.com"}}
+
+		_, err := send(server, emailv1.SMTPSpec{TLSMode: emailv1.SMTPTLSNone}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.rcpts).To(Equal([]string{"one@example.com", "two@example.com", "oncall@example.com", "audit@example.com"}))
+		parsed, err := mail.ReadMessage(strings.NewReader(server.data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Header.Get("Cc")).To(Equal("oncall@example.com"))
+		Expect(parsed.Header.Get("Bcc")).To(BeEmpty())
+		Expect(server.data).NotTo(ContainSubstring("audit@example.com"))
+	})
+
+	It("reports rejected recipients and delivers to the rest", func() {
+		server := newSMTPStandIn(emailv1.SMTPTLSNone)
+		defer server.Close()
+		server.reject = map[string]bool{"two@example.com": true}
+
+		p := newProvider(server, emailv1.SMTPSpec{TLSMode: emailv1.SMTPTLSNone}, nil)
+		_, results, err := p.(recipientReporter).SendReportingRecipients(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.rcpts).To(Equal([]string{"one@example.com"}))
+		Expect(results).To(HaveLen(2))
+		Expect(results[0]).To(Equal(RecipientResult{Email: "one@example.com"}))
+		Expect(results[1].Email).To(Equal("two@example.com"))
+		Expect(results[1].Err).To(MatchError(ContainSubstring("No such user")))
+	})
+
+	It("fails when every recipient is rejected", func() {
+		server := newSMTPStandIn(emailv1.SMTPTLSNone)
+		defer server.Close()
+		server.reject = map[string]bool{"one@example.com": true, "two@example.com": true}
+
+		_, err := send(server, emailv1.SMTPSpec{TLSMode: emailv1.SMTPTLSNone}, nil)
+		Expect(err).To(MatchError(ContainSubstring("RCPT TO two@example.com rejected")))
+		Expect(server.data).To(BeEmpty())
+	})
+
+	It("defaults the port from the TLS mode", func() {
+		p, err := newSMTPProvider(ProviderConfig{Spec: emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{
+			SMTP: &emailv1.SMTPSpec{Host: "relay", TLSMode: emailv1.SMTPTLSImplicit},
+		}}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.(*smtpProvider).port).To(Equal(465))
+	})
+})
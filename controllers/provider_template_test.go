@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// templateMessage is contractMessage sent with a provider template.
+func templateMessage() *Message {
+	msg := contractMessage()
+	msg.HTML, msg.Text = "", ""
+	msg.Template = &ProviderTemplate{
+		ID:        "welcome",
+		Variables: map[string]interface{}{"plan": "free", "team": "Ops"},
+	}
+	return msg
+}
+
+var _ = Describe("Provider templates", func() {
+	It("converts the Email's providerTemplate", func() {
+		email := &emailv1.Email{Spec: emailv1.EmailSpec{
+			RecipientEmail: "recipient@example.com",
+			ProviderTemplate: &emailv1.ProviderTemplate{
+				ID:        "welcome",
+				Variables: map[string]apiextensionsv1.JSON{"plan": {Raw: []byte(`"free"`)}},
+				Personalization: []emailv1.TemplatePersonalization{{
+					Email:     "Recipient@example.com",
+					Variables: map[string]apiextensionsv1.JSON{"plan": {Raw: []byte(`"pro"`)}},
+				}},
+			},
+		}}
+		msg, err := newMessage(email, "sender@example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Text).To(BeEmpty())
+		Expect(msg.Template.ID).To(Equal("welcome"))
+		Expect(msg.Template.VariablesFor("recipient@example.com")).To(Equal(map[string]interface{}{"plan": "pro"}))
+		Expect(msg.Template.VariablesFor("other@example.com")).To(Equal(map[string]interface{}{"plan": "free"}))
+
+		email.Spec.Body = "Hi"
+		_, err = newMessage(email, "sender@example.com")
+		Expect(err).To(MatchError(ContainSubstring("cannot be combined with htmlBody, textBody, body or templateRef")))
+	})
+
+	It("sends SendGrid dynamic templates with one personalization per personalized recipient", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			var body sendGridMessage
+			decodeJSON(r, &body)
+			Expect(body.TemplateID).To(Equal("welcome"))
+			Expect(body.Content).To(BeEmpty())
+			Expect(body.Personalizations).To(HaveLen(2))
+			Expect(body.Personalizations[0].To).To(Equal([]sendGridAddress{{Email: "recipient@example.com", Name: "Recipient"}}))
+			Expect(body.Personalizations[0].Bcc).To(Equal([]sendGridAddress{{Email: "audit@example.com"}}))
+			Expect(body.Personalizations[0].DynamicTemplateData).To(Equal(map[string]interface{}{"plan": "pro", "team": "Ops"}))
+			Expect(body.Personalizations[1].Cc).To(BeEmpty())
+			Expect(body.Personalizations[1].DynamicTemplateData).To(Equal(map[string]interface{}{"plan": "free", "team": "Ops"}))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		msg := templateMessage()
+		msg.To = append(msg.To, Address{Email: "second@example.com"})
+		msg.Template.Personalization = map[string]map[string]interface{}{"recipient@example.com": {"plan": "pro"}}
+		p := &sendGridProvider{apiKey: "key", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends Mailgun templates with their variables", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.ParseForm()).To(Succeed())
+			Expect(r.PostForm.Get("template")).To(Equal("welcome"))
+			Expect(r.PostForm.Get("t:variables")).To(MatchJSON(`{"plan":"free","team":"Ops"}`))
+			Expect(r.PostForm.Get("recipient-variables")).To(MatchJSON(`{"recipient@example.com":{"plan":"pro","team":"Ops"}}`))
+			Expect(r.PostForm["html"]).To(BeEmpty())
+			_, _ = w.Write([]byte(`{"id":"<1@mg.example.com>"}`))
+		}))
+		defer server.Close()
+
+		msg := templateMessage()
+		msg.Template.Personalization = map[string]map[string]interface{}{"recipient@example.com": {"plan": "pro"}}
+		p := &mailgunProvider{apiKey: "key", domain: "mg.example.com", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends Postmark templates by alias or id", func() {
+		var requests []map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/email/withTemplate"))
+			var body map[string]interface{}
+			decodeJSON(r, &body)
+			requests = append(requests, body)
+			_, _ = w.Write([]byte(`{"MessageID":"pm-1","ErrorCode":0}`))
+		}))
+		defer server.Close()
+
+		p := &postmarkProvider{serverToken: "token", baseURL: server.URL, client: server.Client()}
+		msg := templateMessage()
+		_, err := p.Send(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+		msg.Template.ID = "1234"
+		_, err = p.Send(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0]).To(HaveKeyWithValue("TemplateAlias", "welcome"))
+		Expect(requests[0]).To(HaveKeyWithValue("TemplateModel", map[string]interface{}{"plan": "free", "team": "Ops"}))
+		Expect(requests[0]).NotTo(HaveKey("Subject"))
+		Expect(requests[1]).To(HaveKeyWithValue("TemplateId", float64(1234)))
+	})
+
+	It("refuses Postmark personalization for several recipients", func() {
+		msg := templateMessage()
+		msg.Template.Personalization = map[string]map[string]interface{}{"recipient@example.com": {"plan": "pro"}}
+		p := &postmarkProvider{serverToken: "token", baseURL: "http://127.0.0.1:1"}
+		_, err := p.Send(context.Background(), msg)
+		Expect(err).To(MatchError(ContainSubstring("single recipient")))
+	})
+
+	It("is only supported by providers with template APIs", func() {
+		Expect(supportsTemplates(&mailerSendProvider{})).To(BeTrue())
+		Expect(supportsTemplates(&postmarkProvider{})).To(BeTrue())
+		Expect(supportsTemplates(&smtpProvider{})).To(BeFalse())
+		Expect(supportsTemplates(&sesProvider{})).To(BeFalse())
+	})
+})
@@ -0,0 +1,850 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeProvider records the messages it is asked to send.
+type fakeProvider struct {
+	config ProviderConfig
+	sent   []*Message
+	err    error
+	// sending, when set, is called with each message before it is sent.
+	sending func(msg *Message)
+}
+
+func (p *fakeProvider) Name() string { return "Fake" }
+
+func (p *fakeProvider) Validate() error {
+	if len(p.config.Secret["api-token"]) == 0 {
+		return errors.New("secret key api-token is empty")
+	}
+	return nil
+}
+
+func (p *fakeProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	if p.sending != nil {
+		p.sending(msg)
+	}
+	if p.err != nil {
+		return "", p.err
+	}
+	p.sent = append(p.sent, msg)
+	return "fake-message-id", nil
+}
+
+// reportingProvider is a fakeProvider that also reports per-recipient results.
+type reportingProvider struct {
+	*fakeProvider
+	results []RecipientResult
+}
+
+func (p *reportingProvider) SendReportingRecipients(ctx context.Context, msg *Message) (string, []RecipientResult, error) {
+	messageID, err := p.Send(ctx, msg)
+	return messageID, p.results, err
+}
+
+// schedulingProvider is a fakeProvider that can hold messages for a day.
+type schedulingProvider struct {
+	*fakeProvider
+}
+
+func (p *schedulingProvider) maxScheduleAhead() time.Duration { return 24 * time.Hour }
+
+// findingProvider is a fakeProvider that can look up sent messages by
+// idempotency key.
+type findingProvider struct {
+	*fakeProvider
+	found map[string]string
+}
+
+func (p *findingProvider) FindSent(ctx context.Context, key string) (string, bool, error) {
+	messageID, ok := p.found[key]
+	return messageID, ok, nil
+}
+
+// toRequiringProvider is a fakeProvider whose API needs a To recipient.
+type toRequiringProvider struct {
+	*fakeProvider
+}
+
+func (p *toRequiringProvider) requiresTo() {}
+
+// showingProvider is a fakeProvider that never sends, recording the
+// messages it is shown instead.
+type showingProvider struct {
+	*fakeProvider
+	shown []string
+}
+
+func (p *showingProvider) showRendered(ctx context.Context, messageID string, msg *Message, raw []byte) {
+	p.shown = append(p.shown, messageID)
+}
+
+func newTestScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	Expect(emailv1.AddToScheme(s)).To(Succeed())
+	return s
+}
+
+var _ = Describe("ProviderRegistry", func() {
+	It("rejects unknown providers", func() {
+		_, err := NewProviderRegistry().New("Nope", ProviderConfig{})
+		Expect(err).To(MatchError(ContainSubstring(`unknown email provider "Nope"`)))
+	})
+
+	It("validates providers it builds", func() {
+		registry := NewProviderRegistry()
+		registry.Register("Fake", func(config ProviderConfig) (Provider, error) {
+			return &fakeProvider{config: config}, nil
+		})
+		_, err := registry.New("Fake", ProviderConfig{})
+		Expect(err).To(MatchError(ContainSubstring("api-token is empty")))
+	})
+
+	It("registers MailerSend by default", func() {
+		Expect(DefaultProviders.Names()).To(ContainElement("MailerSend"))
+	})
+})
+
+var _ = Describe("EmailReconciler with a registered provider", func() {
+	var (
+		ctx      context.Context
+		provider *fakeProvider
+		recorder *record.FakeRecorder
+		r        *EmailReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		provider = &fakeProvider{}
+		registry := NewProviderRegistry()
+		registry.Register("Fake", func(config ProviderConfig) (Provider, error) {
+			provider.config = config
+			return provider, nil
+		})
+
+		s := newTestScheme()
+		recorder = record.NewFakeRecorder(10)
+		r = &EmailReconciler{
+			Client: fake.NewClientBuilder().WithScheme(s).WithObjects(
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+					Data: map[string][]byte{
+						"api-token":  []byte("secret"),
+						"from-email": []byte("sender@example.com"),
+					},
+				},
+				&emailv1.EmailSenderConfig{
+					ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+					Spec: emailv1.EmailSenderConfigSpec{
+						ApiTokenSecretRef: "token",
+						ProviderSettings:  emailv1.ProviderSettings{Provider: "Fake"},
+					},
+					Status: emailv1.EmailSenderConfigStatus{
+						Conditions: []metav1.Condition{{Type: emailv1.ConditionReady, Status: metav1.ConditionTrue, Reason: "Verified"}},
+					},
+				},
+				&emailv1.Email{
+					ObjectMeta: metav1.ObjectMeta{Name: "email", Namespace: "default"},
+					Spec: emailv1.EmailSpec{
+						SenderConfigRef: "config",
+						RecipientEmail:  "recipient@example.com",
+						Subject:         "Hello",
+						Body:            "World",
+					},
+				},
+			).Build(),
+			Scheme:    s,
+			Recorder:  recorder,
+			Providers: registry,
+		}
+	})
+
+	reconcileEmail := func() *emailv1.Email {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		return &email
+	}
+
+	It("sends through the provider named by the sender config", func() {
+		email := reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+		Expect(email.Status.MessageID).To(Equal("fake-message-id"))
+		Expect(provider.sent).To(HaveLen(1))
+		Expect(provider.sent[0].From.Email).To(Equal("sender@example.com"))
+		Expect(provider.sent[0].To).To(Equal([]Address{{Email: "recipient@example.com"}}))
+		Expect(email.Status.Provider).To(Equal("Fake"))
+		Expect(meta.IsStatusConditionTrue(email.Status.Conditions, emailv1.ConditionSent)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(email.Status.Conditions, emailv1.ConditionReady)).To(BeTrue())
+	})
+
+	It("sends from the Email's sender when the sender config allows it", func() {
+		var config emailv1.EmailSenderConfig
+		Expect(r.Get(ctx, client.ObjectKey{Name: "config", Namespace: "default"}, &config)).To(Succeed())
+		config.Spec.SenderEmail = "noreply@example.com"
+		config.Spec.AllowedSenders = []string{"billing@example.com"}
+		Expect(r.Update(ctx, &config)).To(Succeed())
+		Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+		Expect(provider.sent[0].From.Email).To(Equal("noreply@example.com"))
+
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.SenderEmail = "ceo@example.com"
+		email.Status.DeliveryStatus = ""
+		Expect(r.Update(ctx, &email)).To(Succeed())
+		Expect(r.Status().Update(ctx, &email)).To(Succeed())
+		updated := reconcileEmail()
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(updated.Status.Error).To(Equal("sender ceo@example.com is not allowed by EmailSenderConfig config"))
+		Expect(provider.sent).To(HaveLen(1))
+		// The rejected sender never reached the provider.
+		Expect(updated.Status.Attempts).To(Equal(int32(1)))
+	})
+
+	It("records provider errors in the status", func() {
+		provider.err = errors.New("boom")
+		email := reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(email.Status.Error).To(Equal("boom"))
+	})
+
+	It("requeues retryable provider errors with backoff", func() {
+		provider.err = &RetryableError{Err: errors.New("throttled")}
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", defaultInitialBackoff, defaultInitialBackoff/5))
+
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseRetrying))
+		Expect(email.Status.Error).To(Equal("throttled"))
+		Expect(email.Status.Attempts).To(Equal(int32(1)))
+		Expect(email.Status.LastAttemptTime).NotTo(BeNil())
+		Expect(email.Status.NextRetryTime.Sub(email.Status.LastAttemptTime.Time)).To(BeNumerically("~", result.RequeueAfter, time.Second))
+
+		// Reconciles before the retry is due wait instead of sending.
+		provider.err = nil
+		result, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(provider.sent).To(BeEmpty())
+
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Status.NextRetryTime = &metav1.Time{Time: time.Now().Add(-time.Second)}
+		Expect(r.Status().Update(ctx, &email)).To(Succeed())
+		updated := reconcileEmail()
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+		Expect(updated.Status.Attempts).To(Equal(int32(2)))
+		Expect(updated.Status.NextRetryTime).To(BeNil())
+		Expect(provider.sent).To(HaveLen(1))
+	})
+
+	It("waits as long as the provider asks", func() {
+		provider.err = &RetryableError{Err: errors.New("throttled"), RetryAfter: time.Hour}
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Hour))
+	})
+
+	It("fails emails that run out of attempts", func() {
+		provider.err = &httpStatusError{Provider: "Fake", StatusCode: 503, Body: "unavailable"}
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Status.Attempts = defaultMaxAttempts - 1
+		Expect(r.Status().Update(ctx, &email)).To(Succeed())
+
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(email.Status.Error).To(Equal("giving up after attempt 10: Fake returned 503 Service Unavailable: unavailable"))
+	})
+
+	It("gives up when a retry would pass the retry policy's deadline", func() {
+		provider.err = &httpStatusError{Provider: "Fake", StatusCode: 503, Body: "unavailable"}
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.RetryPolicy = &emailv1.RetryPolicy{Deadline: &metav1.Duration{Duration: 5 * time.Second}}
+		Expect(r.Update(ctx, &email)).To(Succeed())
+
+		email = *reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(email.Status.Error).To(Equal("giving up after attempt 1, retrying would pass the 5s deadline: Fake returned 503 Service Unavailable: unavailable"))
+	})
+
+	It("fails over and retries only the status codes the retry policy lists", func() {
+		provider.err = &httpStatusError{Provider: "Fake", StatusCode: 503, Body: "unavailable"}
+		var config emailv1.EmailSenderConfig
+		Expect(r.Get(ctx, client.ObjectKey{Name: "config", Namespace: "default"}, &config)).To(Succeed())
+		config.Spec.RetryPolicy = &emailv1.RetryPolicy{RetryableStatusCodes: []int32{429}}
+		Expect(r.Update(ctx, &config)).To(Succeed())
+
+		email := reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(email.Status.Attempts).To(Equal(int32(1)))
+	})
+
+	It("retries emails whose attachment source does not exist yet", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.Attachments = []emailv1.Attachment{{Filename: "daily.csv", ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "reports"}, Key: "daily.csv"}}}
+		Expect(r.Update(ctx, &email)).To(Succeed())
+		updated := reconcileEmail()
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseRetrying))
+		Expect(updated.Status.Error).To(Equal("attachment daily.csv: ConfigMap reports not found"))
+		Expect(updated.Status.Attempts).To(BeZero())
+		Expect(updated.Status.NextRetryTime).NotTo(BeNil())
+		Expect(provider.sent).To(BeEmpty())
+
+		Expect(r.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "reports", Namespace: "default"},
+			Data:       map[string]string{"daily.csv": "a,b\n"},
+		})).To(Succeed())
+		updated.Status.NextRetryTime = nil
+		Expect(r.Status().Update(ctx, updated)).To(Succeed())
+		Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+		Expect(provider.sent[0].Attachments).To(HaveLen(1))
+	})
+
+	It("waits for a missing sender config", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.SenderConfigRef = "later"
+		Expect(r.Update(ctx, &email)).To(Succeed())
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).To(HaveOccurred())
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhasePending))
+		Expect(email.Status.Error).To(Equal("EmailSenderConfig not found"))
+	})
+
+	It("waits for a sender config that is not ready", func() {
+		configKey := client.ObjectKey{Name: "config", Namespace: "default"}
+		var config emailv1.EmailSenderConfig
+		Expect(r.Get(ctx, configKey, &config)).To(Succeed())
+		config.Status.Conditions = []metav1.Condition{{
+			Type:    emailv1.ConditionReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidCredentials",
+			Message: "backend default: Fake returned 401 Unauthorized: bad token",
+		}}
+		Expect(r.Status().Update(ctx, &config)).To(Succeed())
+
+		email := reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhasePending))
+		Expect(email.Status.Error).To(Equal("EmailSenderConfig config is not ready: InvalidCredentials: backend default: Fake returned 401 Unauthorized: bad token"))
+		Expect(provider.sent).To(BeEmpty())
+		Expect(r.emailsForConfig(&config)).To(ConsistOf(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(email)}))
+
+		// Dry runs wait too.
+		email.Spec.DryRun = true
+		Expect(r.Update(ctx, email)).To(Succeed())
+		email = reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhasePending))
+		email.Spec.DryRun = false
+		Expect(r.Update(ctx, email)).To(Succeed())
+
+		// Emails being retried stay Retrying, and come back by the time
+		// they expire.
+		email.Status.DeliveryStatus = emailv1.EmailPhaseRetrying
+		Expect(r.Status().Update(ctx, email)).To(Succeed())
+		email.Spec.ExpireAt = &metav1.Time{Time: time.Now().Add(time.Minute)}
+		Expect(r.Update(ctx, email)).To(Succeed())
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(email)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Minute, time.Second))
+		email = reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseRetrying))
+		ready := meta.FindStatusCondition(email.Status.Conditions, emailv1.ConditionReady)
+		Expect(ready.Reason).To(Equal("SenderConfigNotReady"))
+		Expect(ready.Message).To(Equal(email.Status.Error))
+		email.Spec.ExpireAt = nil
+		Expect(r.Update(ctx, email)).To(Succeed())
+		result, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(email)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(notReadyInterval))
+
+		config.Status.Conditions[0].Status = metav1.ConditionTrue
+		Expect(r.Status().Update(ctx, &config)).To(Succeed())
+		Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+		Expect(r.emailsForConfig(&config)).To(BeEmpty())
+	})
+
+	It("renders instead of sending when the Email is a dry run", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.DryRun = true
+		Expect(r.Update(ctx, &email)).To(Succeed())
+
+		updated := reconcileEmail()
+		Expect(provider.sent).To(BeEmpty())
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseDryRun))
+		Expect(updated.Status.MessageID).NotTo(BeEmpty())
+		Expect(updated.Status.RenderedMessage).To(ContainSubstring("Subject: Hello"))
+		Expect(updated.Status.RenderedMessage).To(ContainSubstring("To: recipient@example.com"))
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal DryRun")))
+	})
+
+	It("previews Markdown bodies in dry runs", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.DryRun = true
+		email.Spec.BodyFormat = emailv1.BodyFormatMarkdown
+		email.Spec.Body = "**World**"
+		Expect(r.Update(ctx, &email)).To(Succeed())
+
+		updated := reconcileEmail()
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseDryRun))
+		Expect(updated.Status.RenderedMessage).To(ContainSubstring("multipart/alternative"))
+		Expect(updated.Status.RenderedMessage).To(ContainSubstring("<p><strong>World</strong></p>"))
+	})
+
+	It("renders instead of sending with the Log provider", func() {
+		r.Providers.Register("Fake", newLogProvider)
+		email := reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseDryRun))
+		Expect(email.Status.RenderedMessage).To(ContainSubstring("From: sender@example.com"))
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal DryRun")))
+
+		// Rendered Emails are left alone until their spec changes.
+		again := reconcileEmail()
+		Expect(again.ResourceVersion).To(Equal(email.ResourceVersion))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("shows the rendered message through providers that never send", func() {
+		showing := &showingProvider{fakeProvider: provider}
+		r.Providers.Register("Fake", func(config ProviderConfig) (Provider, error) {
+			provider.config = config
+			return showing, nil
+		})
+		email := reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseDryRun))
+		Expect(showing.shown).To(Equal([]string{email.Status.MessageID}))
+		Expect(provider.sent).To(BeEmpty())
+	})
+
+	It("renders the same message for an unchanged Email", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.UID = "4f0b8c1e"
+		email.CreationTimestamp = metav1.NewTime(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+		provider := &logProvider{}
+		msg := &Message{From: Address{Email: "sender@example.com"}, To: []Address{{Email: "recipient@example.com"}}, Text: "World", HTML: "<p>World</p>"}
+
+		_, messageID, err := r.dryRun(ctx, &email, provider, msg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messageID).To(Equal("<4f0b8c1e@example.com>"))
+		rendered := email.Status.RenderedMessage
+		Expect(rendered).To(ContainSubstring("Date: Wed, 01 May 2024 08:00:00 +0000"))
+		Expect(rendered).To(ContainSubstring("multipart/alternative"))
+
+		_, again, err := r.dryRun(ctx, &email, provider, msg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(messageID))
+		Expect(email.Status.RenderedMessage).To(Equal(rendered))
+	})
+
+	It("sends to the To, Cc and Bcc lists", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.To = []emailv1.EmailAddress{{Name: "Second", Email: "second@example.com"}}
+		email.Spec.Cc = []emailv1.EmailAddress{{Name: "On-call", Email: "oncall@example.com"}}
+		email.Spec.Bcc = []emailv1.EmailAddress{{Email: "audit@example.com"}}
+		Expect(r.Update(ctx, &email)).To(Succeed())
+
+		Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+		Expect(provider.sent).To(HaveLen(1))
+		Expect(provider.sent[0].To).To(Equal([]Address{{Email: "recipient@example.com"}, {Name: "Second", Email: "second@example.com"}}))
+		Expect(provider.sent[0].Cc).To(Equal([]Address{{Name: "On-call", Email: "oncall@example.com"}}))
+		Expect(provider.sent[0].Bcc).To(Equal([]Address{{Email: "audit@example.com"}}))
+	})
+
+	It("fails Emails without recipients", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.RecipientEmail = ""
+		Expect(r.Update(ctx, &email)).To(Succeed())
+
+		updated := reconcileEmail()
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(updated.Status.Error).To(Equal("email has no recipients"))
+		Expect(provider.sent).To(BeEmpty())
+	})
+
+	It("records per-recipient results when the provider reports them", func() {
+		r.Providers.Register("Fake", func(config ProviderConfig) (Provider, error) {
+			provider.config = config
+			return &reportingProvider{fakeProvider: provider, results: []RecipientResult{
+				{Email: "recipient@example.com"},
+				{Email: "gone@example.com", Err: errors.New("550 No such user")},
+			}}, nil
+		})
+
+		email := reconcileEmail()
+		Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+		Expect(email.Status.Recipients).To(Equal([]emailv1.RecipientStatus{
+			{Email: "recipient@example.com", Accepted: true},
+			{Email: "gone@example.com", Error: "550 No such user"},
+		}))
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning RecipientRejected gone@example.com")))
+	})
+
+	It("fails Bcc-only Emails on providers that need a To recipient", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.RecipientEmail = ""
+		email.Spec.Bcc = []emailv1.EmailAddress{{Email: "audit@example.com"}}
+		Expect(r.Update(ctx, &email)).To(Succeed())
+		r.Providers.Register("Fake", func(config ProviderConfig) (Provider, error) {
+			provider.config = config
+			return &toRequiringProvider{fakeProvider: provider}, nil
+		})
+
+		updated := reconcileEmail()
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(updated.Status.Error).To(Equal("backend default: provider Fake needs at least one To recipient"))
+		Expect(provider.sent).To(BeEmpty())
+
+		for _, p := range []Provider{&sendGridProvider{}, &postmarkProvider{}, &mailerSendProvider{}, &mailgunProvider{}} {
+			Expect(requiresTo(p)).To(BeTrue(), p.Name())
+		}
+		Expect(requiresTo(&sesProvider{})).To(BeFalse())
+	})
+
+	It("fails provider templates on providers without a template API", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		var email emailv1.Email
+		Expect(r.Get(ctx, key, &email)).To(Succeed())
+		email.Spec.Body = ""
+		email.Spec.ProviderTemplate = &emailv1.ProviderTemplate{ID: "welcome"}
+		Expect(r.Update(ctx, &email)).To(Succeed())
+
+		updated := reconcileEmail()
+		Expect(updated.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+		Expect(updated.Status.Error).To(Equal("backend default: provider Fake does not support provider templates"))
+		Expect(provider.sent).To(BeEmpty())
+	})
+
+	Context("with a send time", func() {
+		schedule := func(sendAt time.Time, expireAt *metav1.Time) {
+			key := client.ObjectKey{Name: "email", Namespace: "default"}
+			var email emailv1.Email
+			Expect(r.Get(ctx, key, &email)).To(Succeed())
+			email.Spec.SendAt = sendAt.UTC().Format(time.RFC3339)
+			email.Spec.ExpireAt = expireAt
+			Expect(r.Update(ctx, &email)).To(Succeed())
+		}
+
+		It("requeues until the email is due", func() {
+			schedule(time.Now().Add(time.Hour), nil)
+			key := client.ObjectKey{Name: "email", Namespace: "default"}
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+
+			var email emailv1.Email
+			Expect(r.Get(ctx, key, &email)).To(Succeed())
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseScheduled))
+			Expect(email.Status.ScheduledFor).NotTo(BeNil())
+			Expect(provider.sent).To(BeEmpty())
+			Expect(recorder.Events).To(Receive(HavePrefix("Normal Scheduled Holding email until")))
+		})
+
+		It("sends emails that are due", func() {
+			schedule(time.Now().Add(-time.Minute), nil)
+			Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(provider.sent).To(HaveLen(1))
+			Expect(provider.sent[0].SendAt).To(BeZero())
+		})
+
+		It("hands emails to providers that can schedule them", func() {
+			scheduling := &schedulingProvider{provider}
+			r.Providers.Register("Fake", func(config ProviderConfig) (Provider, error) {
+				provider.config = config
+				return scheduling, nil
+			})
+			sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+			schedule(sendAt, nil)
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(email.Status.ScheduledFor.Time).To(BeTemporally("==", sendAt))
+			Expect(provider.sent).To(HaveLen(1))
+			Expect(provider.sent[0].SendAt).To(BeTemporally("==", sendAt))
+
+			// Too far ahead for the provider, so the operator waits instead.
+			email.Status.DeliveryStatus = ""
+			Expect(r.Status().Update(ctx, email)).To(Succeed())
+			schedule(time.Now().Add(48*time.Hour), nil)
+			Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseScheduled))
+			Expect(provider.sent).To(HaveLen(1))
+		})
+
+		It("expires emails that were not sent in time", func() {
+			expireAt := metav1.NewTime(time.Now().Add(-time.Minute))
+			schedule(time.Now().Add(-time.Hour), &expireAt)
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseExpired))
+			Expect(email.Status.Error).To(HavePrefix("email expired at "))
+			Expect(provider.sent).To(BeEmpty())
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning Expired")))
+		})
+	})
+
+	Context("with an attempt in doubt", func() {
+		key := client.ObjectKey{Name: "email", Namespace: "default"}
+		markInDoubt := func() {
+			var email emailv1.Email
+			Expect(r.Get(ctx, key, &email)).To(Succeed())
+			email.Status.DeliveryStatus = emailv1.EmailPhaseSending
+			email.Status.Backend = "default"
+			email.Status.AttemptID = "attempt-1"
+			Expect(r.Status().Update(ctx, &email)).To(Succeed())
+		}
+
+		It("records the attempt before handing it to the provider", func() {
+			provider.sending = func(msg *Message) {
+				defer GinkgoRecover()
+				var email emailv1.Email
+				Expect(r.Get(ctx, key, &email)).To(Succeed())
+				Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSending))
+				Expect(email.Status.Backend).To(Equal("default"))
+				Expect(email.Status.AttemptID).NotTo(BeEmpty())
+				Expect(msg.IdempotencyKey).To(Equal(email.Status.AttemptID))
+			}
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(email.Status.AttemptID).To(BeEmpty())
+			Expect(provider.sent).To(HaveLen(1))
+		})
+
+		It("asks the provider instead of sending again", func() {
+			finder := &findingProvider{fakeProvider: provider, found: map[string]string{"attempt-1": "found-id"}}
+			r.Providers.Register("Fake", func(config ProviderConfig) (Provider, error) {
+				provider.config = config
+				return finder, nil
+			})
+			markInDoubt()
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(email.Status.MessageID).To(Equal("found-id"))
+			Expect(email.Status.AttemptID).To(BeEmpty())
+			Expect(provider.sent).To(BeEmpty())
+		})
+
+		It("sends again under the same key when the provider has no record of it", func() {
+			finder := &findingProvider{fakeProvider: provider}
+			r.Providers.Register("Fake", func(config ProviderConfig) (Provider, error) {
+				provider.config = config
+				return finder, nil
+			})
+			markInDoubt()
+			Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(provider.sent).To(HaveLen(1))
+			Expect(provider.sent[0].IdempotencyKey).To(Equal("attempt-1"))
+		})
+
+		It("sends again with a warning when the provider cannot be asked", func() {
+			markInDoubt()
+			Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(provider.sent).To(HaveLen(1))
+			Expect(provider.sent[0].IdempotencyKey).To(Equal("attempt-1"))
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning InDoubt Fake cannot say whether attempt attempt-1 was sent")))
+		})
+
+		It("keeps the attempt in doubt when the provider times out", func() {
+			provider.err = fmt.Errorf("post: %w", context.DeadlineExceeded)
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseRetrying))
+			Expect(email.Status.AttemptID).NotTo(BeEmpty())
+			Expect(email.Status.Backend).To(Equal("default"))
+		})
+
+		It("checks an expired Email's attempt before expiring it", func() {
+			finder := &findingProvider{fakeProvider: provider, found: map[string]string{"attempt-1": "found-id"}}
+			r.Providers.Register("Fake", func(config ProviderConfig) (Provider, error) {
+				provider.config = config
+				return finder, nil
+			})
+			var email emailv1.Email
+			Expect(r.Get(ctx, key, &email)).To(Succeed())
+			email.Spec.ExpireAt = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+			Expect(r.Update(ctx, &email)).To(Succeed())
+			markInDoubt()
+			Expect(reconcileEmail().Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+
+			finder.found = nil
+			markInDoubt()
+			expiredEmail := reconcileEmail()
+			Expect(expiredEmail.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseExpired))
+			Expect(expiredEmail.Status.Error).To(HavePrefix("email expired at "))
+			Expect(expiredEmail.Status.AttemptID).To(BeEmpty())
+			Expect(provider.sent).To(BeEmpty())
+		})
+
+		It("does not write a stale status over a sent Email", func() {
+			markInDoubt()
+			var stale emailv1.Email
+			Expect(r.Get(ctx, key, &stale)).To(Succeed())
+			sent := reconcileEmail()
+			Expect(sent.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+
+			stale.Status.DeliveryStatus = emailv1.EmailPhaseRetrying
+			Expect(apierrors.IsConflict(r.updateStatus(ctx, &stale))).To(BeTrue())
+			var email emailv1.Email
+			Expect(r.Get(ctx, key, &email)).To(Succeed())
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(email.Status.AttemptID).To(BeEmpty())
+		})
+	})
+
+	Context("with an EmailTemplate", func() {
+		BeforeEach(func() {
+			Expect(r.Create(ctx, &emailv1.EmailTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "welcome", Namespace: "default"},
+				Spec: emailv1.EmailTemplateSpec{
+					Subject:  "Welcome, {{ .name }}",
+					HTMLBody: "<p>Hi {{ .name }}</p>",
+				},
+			})).To(Succeed())
+		})
+
+		useTemplate := func(data string) {
+			key := client.ObjectKey{Name: "email", Namespace: "default"}
+			var email emailv1.Email
+			Expect(r.Get(ctx, key, &email)).To(Succeed())
+			email.Spec.TemplateRef = "welcome"
+			email.Spec.TemplateData = map[string]apiextensionsv1.JSON{}
+			if data != "" {
+				email.Spec.TemplateData["name"] = apiextensionsv1.JSON{Raw: []byte(data)}
+			}
+			Expect(r.Update(ctx, &email)).To(Succeed())
+		}
+
+		It("renders the template before sending", func() {
+			useTemplate(`"<Ada>"`)
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(email.Spec.Subject).To(Equal("Hello"))
+			Expect(provider.sent).To(HaveLen(1))
+			Expect(provider.sent[0].Subject).To(Equal("Welcome, <Ada>"))
+			Expect(provider.sent[0].HTML).To(Equal("<p>Hi &lt;Ada&gt;</p>"))
+			Expect(provider.sent[0].Text).To(Equal("Hi <Ada>"))
+		})
+
+		It("fails with the location of missing template data", func() {
+			useTemplate("")
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+			Expect(email.Status.Error).To(Equal(`EmailTemplate welcome: subject: line 1, column 12: <.name>: map has no entry for key "name"`))
+			Expect(provider.sent).To(BeEmpty())
+		})
+	})
+
+	Context("with a failover chain", func() {
+		var flaky *fakeProvider
+
+		BeforeEach(func() {
+			flaky = &fakeProvider{}
+			r.Providers.Register("Flaky", func(config ProviderConfig) (Provider, error) {
+				flaky.config = config
+				return flaky, nil
+			})
+
+			key := client.ObjectKey{Name: "config", Namespace: "default"}
+			var config emailv1.EmailSenderConfig
+			Expect(r.Get(ctx, key, &config)).To(Succeed())
+			config.Spec.Backends = []emailv1.ProviderBackend{
+				{Name: "primary", ProviderSettings: emailv1.ProviderSettings{Provider: "Flaky"}},
+				{Name: "secondary", ProviderSettings: emailv1.ProviderSettings{Provider: "Fake"}},
+			}
+			Expect(r.Update(ctx, &config)).To(Succeed())
+		})
+
+		It("fails over to the next backend on retryable errors", func() {
+			flaky.err = &httpStatusError{Provider: "Flaky", StatusCode: 503, Body: "unavailable"}
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseSent))
+			Expect(email.Status.Backend).To(Equal("secondary"))
+			Expect(email.Status.DeliveryAttempts).To(HaveLen(2))
+			Expect(email.Status.DeliveryAttempts[0].Backend).To(Equal("primary"))
+			Expect(email.Status.DeliveryAttempts[0].Error).To(ContainSubstring("503"))
+			Expect(email.Status.DeliveryAttempts[1].Backend).To(Equal("secondary"))
+			Expect(email.Status.DeliveryAttempts[1].Error).To(BeEmpty())
+			Expect(provider.sent).To(HaveLen(1))
+
+			var config emailv1.EmailSenderConfig
+			Expect(r.Get(ctx, client.ObjectKey{Name: "config", Namespace: "default"}, &config)).To(Succeed())
+			Expect(config.Status.Backends).To(ConsistOf(
+				emailv1.BackendStatus{Name: "primary", Failed: 1, LastError: "Flaky returned 503 Service Unavailable: unavailable"},
+				emailv1.BackendStatus{Name: "secondary", Sent: 1},
+			))
+			degraded := meta.FindStatusCondition(config.Status.Conditions, emailv1.ConditionDegraded)
+			Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+			Expect(degraded.Reason).To(Equal("BackendFailing"))
+		})
+
+		It("stops at permanent errors", func() {
+			flaky.err = &httpStatusError{Provider: "Flaky", StatusCode: 422, Body: "invalid recipient"}
+			email := reconcileEmail()
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseFailed))
+			Expect(email.Status.DeliveryAttempts).To(HaveLen(1))
+			Expect(provider.sent).To(BeEmpty())
+		})
+
+		It("retries later when every backend fails with a retryable error", func() {
+			flaky.err = &httpStatusError{Provider: "Flaky", StatusCode: 429, Body: "slow down"}
+			provider.err = &httpStatusError{Provider: "Fake", StatusCode: 500, Body: "oops"}
+			key := client.ObjectKey{Name: "email", Namespace: "default"}
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			var email emailv1.Email
+			Expect(r.Get(ctx, key, &email)).To(Succeed())
+			Expect(email.Status.DeliveryStatus).To(Equal(emailv1.EmailPhaseRetrying))
+			Expect(email.Status.DeliveryAttempts).To(HaveLen(2))
+			Expect(email.Status.Attempts).To(Equal(int32(1)))
+		})
+	})
+})
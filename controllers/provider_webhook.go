@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// webhookTemplateFuncs are available to webhook body templates.
+var webhookTemplateFuncs = template.FuncMap{
+	// json renders a value as a JSON literal, so strings are safely quoted.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": strings.Join,
+	// base64 encodes attachment data.
+	"base64": base64.StdEncoding.EncodeToString,
+}
+
+// webhookProvider sends email by calling an arbitrary HTTP endpoint.
+type webhookProvider struct {
+	url           string
+	method        string
+	contentType   string
+	headers       map[string]string
+	body          *template.Template
+	messageIDPath string
+	client        *http.Client
+}
+
+func newWebhookProvider(config ProviderConfig) (Provider, error) {
+	spec := config.Spec.Webhook
+	if spec == nil {
+		return nil, errors.New("spec.webhook is required")
+	}
+
+	p := &webhookProvider{
+		url:           spec.URL,
+		method:        spec.Method,
+		contentType:   spec.ContentType,
+		headers:       map[string]string{},
+		messageIDPath: spec.MessageIDPath,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.method == "" {
+		p.method = http.MethodPost
+	}
+	if p.contentType == "" {
+		p.contentType = "application/json"
+	}
+	for _, h := range spec.Headers {
+		value := h.Value
+		if h.SecretKey != "" {
+			v, ok := config.Secret[h.SecretKey]
+			if !ok {
+				return nil, fmt.Errorf("header %s: secret key %s not found", h.Name, h.SecretKey)
+			}
+			value = string(v)
+		}
+		p.headers[h.Name] = value
+	}
+	if spec.BodyTemplate != "" {
+		tmpl, err := template.New("body").Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(spec.BodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bodyTemplate: %w", err)
+		}
+		p.body = tmpl
+	}
+	return p, nil
+}
+
+func (p *webhookProvider) Name() string {
+	return string(emailv1.ProviderWebhook)
+}
+
+func (p *webhookProvider) Validate() error {
+	if p.url == "" {
+		return errors.New("spec.webhook.url is required")
+	}
+	if p.body == nil {
+		return errors.New("spec.webhook.bodyTemplate is required")
+	}
+	return nil
+}
+
+func (p *webhookProvider) Send(ctx context.Context, msg *Message) (string, error) {
+	log := log.FromContext(ctx)
+
+	var body bytes.Buffer
+	if err := p.body.Execute(&body, msg); err != nil {
+		return "", fmt.Errorf("failed to render webhook body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.method, p.url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", p.contentType)
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	if msg.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", msg.IdempotencyKey)
+	}
+
+	log.Info("Sending email with webhook", "url", p.url, "recipients", msg.Recipients(), "subject", msg.Subject)
+
+	_, resBody, err := doHTTP(p.client, p.Name(), req)
+	if err != nil {
+		return "", err
+	}
+
+	// The gateway has accepted the email by now, so a response without the
+	// message id must not make it look failed and be sent again.
+	var messageID string
+	if p.messageIDPath != "" {
+		if messageID, err = evalJSONPathBytes(resBody, p.messageIDPath); err != nil {
+			log.Error(err, "Webhook accepted the email but its response has no message id", "messageIDPath", p.messageIDPath)
+			messageID = ""
+		}
+	}
+
+	log.Info("Email sent successfully", "messageID", messageID)
+	return messageID, nil
+}
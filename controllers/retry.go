@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+const (
+	// defaultMaxAttempts is how many times an Email is tried before a
+	// retryable error fails it for good.
+	defaultMaxAttempts = 10
+	// defaultInitialBackoff is the wait before the first retry.
+	defaultInitialBackoff = 10 * time.Second
+	// defaultMaxBackoff caps the wait between retries.
+	defaultMaxBackoff = 10 * time.Minute
+	// defaultMultiplier is what the wait grows by after every retry.
+	defaultMultiplier = 2
+	// backoffJitter is the fraction a wait is randomly shortened or
+	// lengthened by, so Emails that failed together do not retry together.
+	backoffJitter = 0.2
+)
+
+// jitter returns a random number in [0, 1). It is a variable for tests.
+var jitter = rand.Float64
+
+// retryPolicy is an emailv1.RetryPolicy with its defaults filled in.
+type retryPolicy struct {
+	maxAttempts    int32
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	// deadline is zero when retries are not bounded in time.
+	deadline time.Duration
+	// statusCodes are the retryable HTTP status codes, or nil for the
+	// default of 429 and 5xx.
+	statusCodes map[int]bool
+}
+
+// newRetryPolicy merges retry policies, later ones overriding the fields
+// they set, over the defaults.
+func newRetryPolicy(specs ...*emailv1.RetryPolicy) (retryPolicy, error) {
+	p := retryPolicy{
+		maxAttempts:    defaultMaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		multiplier:     defaultMultiplier,
+	}
+	for _, spec := range specs {
+		if spec == nil {
+			continue
+		}
+		if spec.MaxAttempts != nil {
+			p.maxAttempts = *spec.MaxAttempts
+		}
+		if spec.InitialBackoff != nil {
+			p.initialBackoff = spec.InitialBackoff.Duration
+		}
+		if spec.MaxBackoff != nil {
+			p.maxBackoff = spec.MaxBackoff.Duration
+		}
+		if spec.Multiplier != "" {
+			multiplier, err := strconv.ParseFloat(spec.Multiplier, 64)
+			if err != nil || multiplier < 1 {
+				return retryPolicy{}, fmt.Errorf("retryPolicy.multiplier %q is not a number of at least 1", spec.Multiplier)
+			}
+			p.multiplier = multiplier
+		}
+		if spec.Deadline != nil {
+			p.deadline = spec.Deadline.Duration
+		}
+		if spec.RetryableStatusCodes != nil {
+			p.statusCodes = make(map[int]bool, len(spec.RetryableStatusCodes))
+			for _, code := range spec.RetryableStatusCodes {
+				p.statusCodes[int(code)] = true
+			}
+		}
+	}
+
+	switch {
+	case p.maxAttempts < 1:
+		return retryPolicy{}, errors.New("retryPolicy.maxAttempts must be at least 1")
+	case p.initialBackoff <= 0:
+		return retryPolicy{}, errors.New("retryPolicy.initialBackoff must be positive")
+	case p.maxBackoff < p.initialBackoff:
+		return retryPolicy{}, fmt.Errorf("retryPolicy.maxBackoff %s is shorter than initialBackoff %s", p.maxBackoff, p.initialBackoff)
+	case p.deadline < 0:
+		return retryPolicy{}, errors.New("retryPolicy.deadline must not be negative")
+	}
+	return p, nil
+}
+
+// backoff returns how long to wait after the given number of attempts: the
+// initial backoff grown by the multiplier for every attempt after the
+// first, capped at the maximum, and jittered without going past it.
+func (p retryPolicy) backoff(attempts int32) time.Duration {
+	maxWait := float64(p.maxBackoff)
+	wait := float64(p.initialBackoff)
+	for i := int32(1); i < attempts && wait < maxWait; i++ {
+		wait *= p.multiplier
+	}
+	wait = math.Min(wait, maxWait)
+	return time.Duration(math.Min(wait*(1+backoffJitter*(2*jitter()-1)), maxWait))
+}
+
+// retryable reports whether a send error is worth retrying. Errors the
+// provider marked retryable always are; other HTTP status errors are judged
+// by the policy's status codes, and everything else by isRetryable.
+func (p retryPolicy) retryable(err error) bool {
+	if asRetryable(err) != nil {
+		return true
+	}
+	var statusErr *httpStatusError
+	if p.statusCodes != nil && errors.As(err, &statusErr) {
+		return p.statusCodes[statusErr.StatusCode]
+	}
+	return isRetryable(err)
+}
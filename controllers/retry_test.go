@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry policies", func() {
+	int32Ptr := func(n int32) *int32 { return &n }
+	duration := func(d time.Duration) *metav1.Duration { return &metav1.Duration{Duration: d} }
+
+	BeforeEach(func() {
+		jitter = func() float64 { return 0.5 }
+	})
+	AfterEach(func() {
+		jitter = rand.Float64
+	})
+
+	It("doubles the wait for every attempt up to the maximum by default", func() {
+		policy, err := newRetryPolicy()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.maxAttempts).To(Equal(int32(10)))
+		Expect(policy.backoff(1)).To(Equal(10 * time.Second))
+		Expect(policy.backoff(2)).To(Equal(20 * time.Second))
+		Expect(policy.backoff(4)).To(Equal(80 * time.Second))
+		Expect(policy.backoff(7)).To(Equal(10 * time.Minute))
+		Expect(policy.backoff(1000)).To(Equal(10 * time.Minute))
+	})
+
+	It("jitters the wait by up to a fifth either way", func() {
+		policy, err := newRetryPolicy()
+		Expect(err).NotTo(HaveOccurred())
+		jitter = func() float64 { return 0 }
+		Expect(policy.backoff(1)).To(Equal(8 * time.Second))
+		jitter = func() float64 { return 0.999999 }
+		Expect(policy.backoff(1)).To(BeNumerically("~", 12*time.Second, time.Millisecond))
+		// Never past the maximum, and still jittered below it.
+		Expect(policy.backoff(1000)).To(Equal(10 * time.Minute))
+		jitter = func() float64 { return 0 }
+		Expect(policy.backoff(1000)).To(Equal(8 * time.Minute))
+	})
+
+	It("lets later policies override the fields they set", func() {
+		config := &emailv1.RetryPolicy{
+			MaxAttempts:    int32Ptr(20),
+			InitialBackoff: duration(time.Minute),
+			MaxBackoff:     duration(time.Hour),
+			Multiplier:     "1.5",
+			Deadline:       duration(24 * time.Hour),
+		}
+		email := &emailv1.RetryPolicy{
+			MaxAttempts: int32Ptr(3),
+			Deadline:    duration(5 * time.Minute),
+		}
+		policy, err := newRetryPolicy(config, email)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.maxAttempts).To(Equal(int32(3)))
+		Expect(policy.deadline).To(Equal(5 * time.Minute))
+		Expect(policy.backoff(1)).To(Equal(time.Minute))
+		Expect(policy.backoff(3)).To(Equal(135 * time.Second))
+	})
+
+	It("rejects invalid policies", func() {
+		_, err := newRetryPolicy(&emailv1.RetryPolicy{Multiplier: "0.5"})
+		Expect(err).To(MatchError(`retryPolicy.multiplier "0.5" is not a number of at least 1`))
+		_, err = newRetryPolicy(&emailv1.RetryPolicy{MaxBackoff: duration(time.Second)})
+		Expect(err).To(MatchError("retryPolicy.maxBackoff 1s is shorter than initialBackoff 10s"))
+		_, err = newRetryPolicy(&emailv1.RetryPolicy{MaxAttempts: int32Ptr(0)})
+		Expect(err).To(MatchError("retryPolicy.maxAttempts must be at least 1"))
+	})
+
+	It("retries only the listed HTTP status codes", func() {
+		policy, err := newRetryPolicy(&emailv1.RetryPolicy{RetryableStatusCodes: []int32{503, 409}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.retryable(&httpStatusError{StatusCode: 409})).To(BeTrue())
+		Expect(policy.retryable(&httpStatusError{StatusCode: 503})).To(BeTrue())
+		Expect(policy.retryable(&httpStatusError{StatusCode: 500})).To(BeFalse())
+		Expect(policy.retryable(&RetryableError{Err: errors.New("timeout")})).To(BeTrue())
+
+		defaults, err := newRetryPolicy()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(defaults.retryable(&httpStatusError{StatusCode: 500})).To(BeTrue())
+		Expect(defaults.retryable(&httpStatusError{StatusCode: 409})).To(BeFalse())
+	})
+
+	It("keeps errors the provider marked retryable retryable whatever the status codes", func() {
+		policy, err := newRetryPolicy(&emailv1.RetryPolicy{RetryableStatusCodes: []int32{503}})
+		Expect(err).NotTo(HaveOccurred())
+		throttled := &RetryableError{Err: &httpStatusError{Provider: "SES", StatusCode: 400, Body: "LimitExceededException"}}
+		Expect(policy.retryable(throttled)).To(BeTrue())
+		Expect(policy.retryable(&httpStatusError{Provider: "SES", StatusCode: 400, Body: "InvalidParameterValue"})).To(BeFalse())
+	})
+})
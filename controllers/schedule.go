@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// localTimeLayout is the layout of a sendAt without an offset.
+const localTimeLayout = "2006-01-02T15:04:05"
+
+// sendTime returns when an Email should go out, or the zero time if it can
+// go out now. A local sendAt is read in the Email's timeZone.
+func sendTime(spec emailv1.EmailSpec) (time.Time, error) {
+	loc := time.UTC
+	if spec.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(spec.TimeZone); err != nil {
+			return time.Time{}, fmt.Errorf("spec.timeZone: unknown time zone %q", spec.TimeZone)
+		}
+	}
+	if spec.SendAt == "" {
+		return time.Time{}, nil
+	}
+
+	sendAt, err := time.Parse(time.RFC3339, spec.SendAt)
+	if err != nil {
+		if sendAt, err = time.ParseInLocation(localTimeLayout, spec.SendAt, loc); err != nil {
+			return time.Time{}, fmt.Errorf("spec.sendAt %q is neither an RFC 3339 time nor a local time like %s", spec.SendAt, localTimeLayout)
+		}
+	}
+	if spec.ExpireAt != nil && !sendAt.Before(spec.ExpireAt.Time) {
+		return time.Time{}, fmt.Errorf("spec.expireAt %s is not after spec.sendAt %s", spec.ExpireAt.UTC().Format(time.RFC3339), sendAt.Format(time.RFC3339))
+	}
+	return sendAt, nil
+}
+
+// expired reports whether an Email's expireAt has passed.
+func expired(email *emailv1.Email, now time.Time) bool {
+	return email.Spec.ExpireAt != nil && !now.Before(email.Spec.ExpireAt.Time)
+}
+
+// expiredError is the error an expired Email is left with.
+func expiredError(email *emailv1.Email) error {
+	return fmt.Errorf("email expired at %s before it was sent", email.Spec.ExpireAt.UTC().Format(time.RFC3339))
+}
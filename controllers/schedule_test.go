@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Send times", func() {
+	It("sends now without a sendAt", func() {
+		Expect(sendTime(emailv1.EmailSpec{})).To(BeZero())
+	})
+
+	It("reads RFC 3339 times with their own offset", func() {
+		sendAt, err := sendTime(emailv1.EmailSpec{SendAt: "2024-05-01T08:00:00+02:00", TimeZone: "America/New_York"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sendAt.UTC()).To(Equal(time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)))
+	})
+
+	It("reads local times in the Email's time zone", func() {
+		sendAt, err := sendTime(emailv1.EmailSpec{SendAt: "2024-05-01T08:00:00", TimeZone: "Asia/Tokyo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sendAt.UTC()).To(Equal(time.Date(2024, 4, 30, 23, 0, 0, 0, time.UTC)))
+
+		sendAt, err = sendTime(emailv1.EmailSpec{SendAt: "2024-05-01T08:00:00"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sendAt).To(Equal(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)))
+	})
+
+	It("rejects unknown time zones and malformed times", func() {
+		_, err := sendTime(emailv1.EmailSpec{SendAt: "2024-05-01T08:00:00", TimeZone: "Mars/Olympus"})
+		Expect(err).To(MatchError(`spec.timeZone: unknown time zone "Mars/Olympus"`))
+		_, err = sendTime(emailv1.EmailSpec{SendAt: "tomorrow"})
+		Expect(err).To(MatchError(`spec.sendAt "tomorrow" is neither an RFC 3339 time nor a local time like 2006-01-02T15:04:05`))
+	})
+
+	It("rejects an expireAt that is not after sendAt", func() {
+		expireAt := metav1.NewTime(time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC))
+		_, err := sendTime(emailv1.EmailSpec{SendAt: "2024-05-01T08:00:00Z", ExpireAt: &expireAt})
+		Expect(err).To(MatchError("spec.expireAt 2024-05-01T07:00:00Z is not after spec.sendAt 2024-05-01T08:00:00Z"))
+	})
+})
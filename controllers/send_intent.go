@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// recordSendIntent marks the Email Sending with the attempt key and backend
+// before the provider is called, so that a send whose outcome never makes
+// it into status is checked rather than repeated. The Email is left as it
+// was if the write fails.
+func (r *EmailReconciler) recordSendIntent(ctx context.Context, email *emailv1.Email, b senderBackend, key string) error {
+	previous := email.Status
+	email.Status.DeliveryStatus = emailv1.EmailPhaseSending
+	email.Status.Backend = b.name
+	email.Status.Provider = providerName(b.settings)
+	email.Status.AttemptID = key
+	setEmailConditions(email)
+	if err := r.Status().Update(ctx, email); err != nil {
+		email.Status = previous
+		return err
+	}
+	return nil
+}
+
+// checkSent asks provider whether the in-doubt attempt key was accepted.
+// When the provider cannot say, or fails to with a permanent error, the
+// attempt is taken as not sent and a Warning Event records that it is sent
+// again.
+func (r *EmailReconciler) checkSent(ctx context.Context, email *emailv1.Email, provider Provider, key string, policy retryPolicy) (string, bool, error) {
+	finder, ok := provider.(sentFinder)
+	if !ok {
+		r.event(email, corev1.EventTypeWarning, "InDoubt", fmt.Sprintf(
+			"%s cannot say whether attempt %s was sent, sending it again", provider.Name(), key))
+		return "", false, nil
+	}
+	messageID, sent, err := finder.FindSent(ctx, key)
+	if err != nil {
+		if policy.retryable(err) {
+			return "", false, fmt.Errorf("failed to check whether attempt %s was sent: %w", key, err)
+		}
+		r.event(email, corev1.EventTypeWarning, "InDoubt", fmt.Sprintf(
+			"Failed to check whether attempt %s was sent, sending it again: %v", key, err))
+		return "", false, nil
+	}
+	return messageID, sent, nil
+}
+
+// mayHaveBeenSent reports whether a send error leaves it unknown whether the
+// provider accepted the message: the request went out but no answer came
+// back in time.
+func mayHaveBeenSent(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return false
+	}
+	// Timing out while connecting means nothing was sent.
+	var opErr *net.OpError
+	return !errors.As(err, &opErr) || opErr.Op != "dial"
+}
+
+// updateStatus writes the Email's status, its conditions brought in line
+// with its phase first. A conflict is returned rather than resolved: the
+// newer version may record a send this reconcile does not know about, so the
+// next reconcile starts again from it.
+func (r *EmailReconciler) updateStatus(ctx context.Context, email *emailv1.Email) error {
+	setEmailConditions(email)
+	return r.Status().Update(ctx, email)
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Idempotency keys", func() {
+	keyedMessage := func() *Message {
+		msg := contractMessage()
+		msg.IdempotencyKey = "attempt-1"
+		return msg
+	}
+
+	It("derives the Message-ID from the key", func() {
+		Expect(messageIDFor(keyedMessage())).To(Equal("<attempt-1@example.com>"))
+		Expect(messageIDFor(contractMessage())).NotTo(Equal(messageIDFor(contractMessage())))
+	})
+
+	It("sends the key to webhooks as an Idempotency-Key header", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("Idempotency-Key")).To(Equal("attempt-1"))
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		p, err := DefaultProviders.New("Webhook", ProviderConfig{
+			Spec: emailv1.EmailSenderConfigSpec{ProviderSettings: emailv1.ProviderSettings{
+				Webhook: &emailv1.WebhookSpec{URL: server.URL, BodyTemplate: `{"key":{{json .IdempotencyKey}}}`},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = p.Send(context.Background(), keyedMessage())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends the key as Postmark metadata and finds messages by it", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("X-Postmark-Server-Token")).To(Equal("token"))
+			switch r.URL.Path {
+			case "/email":
+				var body postmarkMessage
+				decodeJSON(r, &body)
+				Expect(body.Metadata).To(Equal(map[string]string{"attempt_id": "attempt-1"}))
+				_, _ = w.Write([]byte(`{"MessageID":"pm-123"}`))
+			case "/messages/outbound":
+				Expect(r.Method).To(Equal(http.MethodGet))
+				if r.URL.Query().Get("metadata_attempt_id") == "attempt-1" {
+					_, _ = w.Write([]byte(`{"TotalCount":1,"Messages":[{"MessageID":"pm-123"}]}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"TotalCount":0,"Messages":[]}`))
+			}
+		}))
+		defer server.Close()
+
+		p := &postmarkProvider{serverToken: "token", baseURL: server.URL, client: server.Client()}
+		_, err := p.Send(context.Background(), keyedMessage())
+		Expect(err).NotTo(HaveOccurred())
+
+		id, sent, err := p.FindSent(context.Background(), "attempt-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeTrue())
+		Expect(id).To(Equal("pm-123"))
+		_, sent, err = p.FindSent(context.Background(), "attempt-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeFalse())
+	})
+
+	It("sends the key as a SendGrid custom arg and finds messages by it", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			switch r.URL.Path {
+			case "/v3/mail/send":
+				var body sendGridMessage
+				decodeJSON(r, &body)
+				Expect(body.CustomArgs).To(Equal(map[string]string{"attempt_id": "attempt-1"}))
+				w.WriteHeader(http.StatusAccepted)
+			case "/v3/messages":
+				Expect(r.URL.Query().Get("query")).To(Equal(`unique_args['attempt_id']="attempt-1"`))
+				_, _ = w.Write([]byte(`{"messages":[{"msg_id":"sg-123.filter"}]}`))
+			}
+		}))
+		defer server.Close()
+
+		p := &sendGridProvider{apiKey: "key", baseURL: server.URL + "/v3", client: server.Client()}
+		_, err := p.Send(context.Background(), keyedMessage())
+		Expect(err).NotTo(HaveOccurred())
+
+		id, sent, err := p.FindSent(context.Background(), "attempt-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeTrue())
+		Expect(id).To(Equal("sg-123.filter"))
+	})
+
+	It("tags MailerSend emails with the key and finds them in the activity", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/v1/email":
+				var body struct {
+					Tags []string `json:"tags"`
+				}
+				decodeJSON(r, &body)
+				Expect(body.Tags).To(Equal([]string{"attempt-attempt-1"}))
+				w.Header().Set("X-Message-Id", "ms-1")
+				w.WriteHeader(http.StatusAccepted)
+			case "/v1/domains":
+				_, _ = w.Write([]byte(`{"data":[{"id":"d1","name":"example.com"},{"id":"d2","name":"other.com"}],"links":{"next":null}}`))
+			case "/v1/activity/d1":
+				Expect(r.URL.Query().Get("date_from")).NotTo(BeEmpty())
+				_, _ = w.Write([]byte(`{"data":[{"email":{"id":"e1","tags":null}},{"email":{"id":"e2","tags":["other"]}}],"links":{"next":null}}`))
+			case "/v1/activity/d2":
+				if r.URL.Query().Get("page") == "2" {
+					_, _ = w.Write([]byte(`{"data":[{"email":{"id":"e3","tags":["attempt-attempt-1"]}}],"links":{"next":null}}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"data":[{"email":{"id":"e4","tags":[]}}],"links":{"next":"https://api.mailersend.com/v1/activity/d2?page=2"}}`))
+			}
+		}))
+		defer server.Close()
+		target, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		p := &mailerSendProvider{apiToken: "token", client: &http.Client{Transport: redirectTransport{target: target}}}
+		_, err = p.Send(context.Background(), keyedMessage())
+		Expect(err).NotTo(HaveOccurred())
+
+		id, sent, err := p.FindSent(context.Background(), "attempt-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeTrue())
+		Expect(id).To(Equal("e3"))
+		_, sent, err = p.FindSent(context.Background(), "attempt-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeFalse())
+	})
+
+	It("sends the key as a Mailgun user variable and finds messages by it", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			switch r.URL.Path {
+			case "/v3/mg.example.com/messages":
+				Expect(r.ParseForm()).To(Succeed())
+				Expect(r.PostForm.Get("v:attempt-id")).To(Equal("attempt-1"))
+				_, _ = w.Write([]byte(`{"id":"<mg-1@mg.example.com>","message":"Queued. Thank you."}`))
+			case "/v3/mg.example.com/events":
+				if r.URL.Query().Get("page") == "2" {
+					_, _ = w.Write([]byte(`{"items":[],"paging":{"next":"done"}}`))
+					return
+				}
+				Expect(r.URL.Query().Get("event")).To(Equal("accepted"))
+				_, _ = w.Write([]byte(`{"items":[` +
+					`{"user-variables":{},"message":{"headers":{"message-id":"mg-0@mg.example.com"}}},` +
+					`{"user-variables":{"attempt-id":"attempt-1"},"message":{"headers":{"message-id":"mg-1@mg.example.com"}}}],` +
+					`"paging":{"next":"` + "http://" + r.Host + r.URL.Path + `?page=2"}}`))
+			}
+		}))
+		defer server.Close()
+
+		p := &mailgunProvider{apiKey: "key", domain: "mg.example.com", baseURL: server.URL + "/v3", client: server.Client()}
+		_, err := p.Send(context.Background(), keyedMessage())
+		Expect(err).NotTo(HaveOccurred())
+
+		id, sent, err := p.FindSent(context.Background(), "attempt-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeTrue())
+		Expect(id).To(Equal("<mg-1@mg.example.com>"))
+		_, sent, err = p.FindSent(context.Background(), "attempt-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sent).To(BeFalse())
+	})
+
+	It("treats timeouts after connecting as possibly sent", func() {
+		Expect(mayHaveBeenSent(nil)).To(BeFalse())
+		Expect(mayHaveBeenSent(fmt.Errorf("send: %w", context.DeadlineExceeded))).To(BeTrue())
+		Expect(mayHaveBeenSent(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded})).To(BeTrue())
+		Expect(mayHaveBeenSent(&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded})).To(BeFalse())
+		Expect(mayHaveBeenSent(&httpStatusError{StatusCode: 503})).To(BeFalse())
+	})
+})
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// senderEmail picks the address an Email is sent from: the Email's own
+// senderEmail when the sender config allows it, otherwise the config's
+// senderEmail. Configs without one fall back to the from-email key of their
+// Secret.
+func senderEmail(email *emailv1.Email, config emailv1.EmailSenderConfigSpec, secret map[string][]byte) (string, error) {
+	if email.Spec.SenderEmail != "" {
+		if err := validSenderAddress(email.Spec.SenderEmail); err != nil {
+			return "", fmt.Errorf("invalid spec.senderEmail: %w", err)
+		}
+		if !senderAllowed(email.Spec.SenderEmail, config) {
+			return "", fmt.Errorf("sender %s is not allowed by EmailSenderConfig %s", email.Spec.SenderEmail, email.Spec.SenderConfigRef)
+		}
+		return email.Spec.SenderEmail, nil
+	}
+
+	from := config.SenderEmail
+	if from == "" {
+		from = string(secret["from-email"])
+	}
+	if from == "" {
+		return "", fmt.Errorf("EmailSenderConfig %s has no senderEmail", email.Spec.SenderConfigRef)
+	}
+	if err := validSenderAddress(from); err != nil {
+		return "", fmt.Errorf("invalid EmailSenderConfig senderEmail: %w", err)
+	}
+	return from, nil
+}
+
+// validSenderAddress checks addr is a bare email address, without a display
+// name; names are set with fromName.
+func validSenderAddress(addr string) error {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return err
+	}
+	if parsed.Name != "" || parsed.Address != addr {
+		return fmt.Errorf("%q is not a bare email address", addr)
+	}
+	return nil
+}
+
+// senderAllowed reports whether the sender config lets Emails send from
+// addr: it is the config's senderEmail, one of its allowedSenders, or at a
+// domain allowed with an @domain entry.
+func senderAllowed(addr string, config emailv1.EmailSenderConfigSpec) bool {
+	if strings.EqualFold(addr, config.SenderEmail) {
+		return true
+	}
+	domain := addr[strings.LastIndex(addr, "@"):]
+	for _, allowed := range config.AllowedSenders {
+		if strings.EqualFold(allowed, addr) || (strings.HasPrefix(allowed, "@") && strings.EqualFold(allowed, domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// replyToAddress converts a Reply-To address, checking it parses.
+func replyToAddress(field string, a *emailv1.EmailAddress) (*Address, error) {
+	if a == nil {
+		return nil, nil
+	}
+	if _, err := mail.ParseAddress(a.Email); err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", field, a.Email, err)
+	}
+	return &Address{Name: a.Name, Email: a.Email}, nil
+}
+
+// applySenderDefaults fills in the display name and Reply-To of msg from the
+// sender config where the Email did not set them.
+func applySenderDefaults(msg *Message, spec emailv1.EmailSenderConfigSpec) error {
+	if msg.From.Name == "" {
+		msg.From.Name = spec.FromName
+	}
+	if msg.ReplyTo == nil {
+		replyTo, err := replyToAddress("EmailSenderConfig replyTo", spec.ReplyTo)
+		if err != nil {
+			return err
+		}
+		msg.ReplyTo = replyTo
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sender identities", func() {
+	config := emailv1.EmailSenderConfigSpec{
+		SenderEmail:    "noreply@example.com",
+		AllowedSenders: []string{"billing@example.com", "@alerts.example.com"},
+	}
+	secret := map[string][]byte{"from-email": []byte("legacy@example.com")}
+	sender := func(addr string, config emailv1.EmailSenderConfigSpec) (string, error) {
+		email := &emailv1.Email{Spec: emailv1.EmailSpec{SenderConfigRef: "config", SenderEmail: addr}}
+		return senderEmail(email, config, secret)
+	}
+
+	It("sends from the sender config's senderEmail rather than the Secret", func() {
+		Expect(sender("", config)).To(Equal("noreply@example.com"))
+	})
+
+	It("falls back to the Secret's from-email for configs without a senderEmail", func() {
+		Expect(sender("", emailv1.EmailSenderConfigSpec{})).To(Equal("legacy@example.com"))
+		email := &emailv1.Email{Spec: emailv1.EmailSpec{SenderConfigRef: "config"}}
+		_, err := senderEmail(email, emailv1.EmailSenderConfigSpec{}, nil)
+		Expect(err).To(MatchError("EmailSenderConfig config has no senderEmail"))
+	})
+
+	It("lets Emails pick an allowed sender", func() {
+		Expect(sender("billing@example.com", config)).To(Equal("billing@example.com"))
+		Expect(sender("Billing@Example.com", config)).To(Equal("Billing@Example.com"))
+		Expect(sender("pager@alerts.example.com", config)).To(Equal("pager@alerts.example.com"))
+		Expect(sender("noreply@example.com", config)).To(Equal("noreply@example.com"))
+	})
+
+	It("refuses senders outside the allow-list", func() {
+		for _, addr := range []string{"ceo@example.com", "legacy@example.com", "pager@evil-alerts.example.com", "x@sub.alerts.example.com"} {
+			_, err := sender(addr, config)
+			Expect(err).To(MatchError("sender "+addr+" is not allowed by EmailSenderConfig config"), addr)
+		}
+		_, err := sender("Billing <billing@example.com>", config)
+		Expect(err).To(MatchError(ContainSubstring("not a bare email address")))
+	})
+})
@@ -85,7 +85,7 @@ var _ = Describe("Email Controller", func() {
                                         Name:      email.Name,
                                 }, email)
                                 Expect(err).ToNot(HaveOccurred())
-                                return email.Status.DeliveryStatus
+                                return string(email.Status.DeliveryStatus)
                         }, time.Second*10).Should(Equal("Sent"))
                 })
         })
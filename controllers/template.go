@@ -0,0 +1,415 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+)
+
+// templateFuncs are the sprig-like helpers available to email templates.
+var templateFuncs = template.FuncMap{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      strings.Title,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       templateJoin,
+	"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+	"indent":     templateIndent,
+	"nindent":    func(spaces int, s string) string { return "\n" + templateIndent(spaces, s) },
+	"quote":      func(v interface{}) string { return strconv.Quote(fmt.Sprint(v)) },
+	"default":    templateDefault,
+	"empty":      isEmptyValue,
+	"coalesce":   templateCoalesce,
+	"ternary": func(yes, no interface{}, cond bool) interface{} {
+		if cond {
+			return yes
+		}
+		return no
+	},
+	"list": func(v ...interface{}) []interface{} { return v },
+	"dict": templateDict,
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+	"now":  time.Now,
+	"date": templateDate,
+	"add":  func(a, b int) int { return a + b },
+	"sub":  func(a, b int) int { return a - b },
+	"mul":  func(a, b int) int { return a * b },
+	"div": func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	},
+}
+
+func templateJoin(sep string, v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Sprint(v)
+	}
+	parts := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		parts = append(parts, fmt.Sprint(rv.Index(i).Interface()))
+	}
+	return strings.Join(parts, sep)
+}
+
+func templateIndent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// templateDefault returns given, or def when given is empty. It takes the
+// default first so it reads well in pipelines: {{ .name | default "there" }}.
+func templateDefault(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmptyValue(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+func templateCoalesce(v ...interface{}) interface{} {
+	for _, val := range v {
+		if !isEmptyValue(val) {
+			return val
+		}
+	}
+	return nil
+}
+
+func templateDict(v ...interface{}) (map[string]interface{}, error) {
+	if len(v)%2 != 0 {
+		return nil, errors.New("dict requires key and value pairs")
+	}
+	dict := make(map[string]interface{}, len(v)/2)
+	for i := 0; i < len(v); i += 2 {
+		key, ok := v[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", v[i])
+		}
+		dict[key] = v[i+1]
+	}
+	return dict, nil
+}
+
+// templateDate formats a time, or an RFC 3339 string, with a Go layout.
+func templateDate(layout string, v interface{}) (string, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Format(layout), nil
+	default:
+		return "", fmt.Errorf("date: unsupported value %v", v)
+	}
+}
+
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// renderedContent is the subject and bodies produced by rendering templates.
+type renderedContent struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// TemplateError is a template parse or execution error, located in the
+// field of the template it came from.
+type TemplateError struct {
+	// Field is the template field, such as subject or htmlBody.
+	Field string
+	// Line and Column locate the error in the field. Column is 0 when
+	// unknown, as it is for parse errors.
+	Line, Column int
+	Message      string
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	if e.Column == 0 {
+		return fmt.Sprintf("%s: line %d: %s", e.Field, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: line %d, column %d: %s", e.Field, e.Line, e.Column, e.Message)
+}
+
+// templateErrorPattern matches the "template: NAME:LINE[:COL]: MSG" form of
+// text/template and html/template errors.
+var templateErrorPattern = regexp.MustCompile(`^(?:html/)?template: [^:]+:(\d+)(?::(\d+))?: (.*)$`)
+
+// newTemplateError locates a text/template or html/template error.
+func newTemplateError(field string, err error) *TemplateError {
+	te := &TemplateError{Field: field, Message: err.Error()}
+	m := templateErrorPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return te
+	}
+	te.Line, _ = strconv.Atoi(m[1])
+	te.Column, _ = strconv.Atoi(m[2])
+	// Drop the template name from execution errors, it is already in Field.
+	te.Message = strings.TrimPrefix(m[3], fmt.Sprintf("executing %q at ", field))
+	return te
+}
+
+// renderText renders a text/template. Missing keys are errors so that a
+// typo never sends an email with a blank where a value should be.
+func renderText(field, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(field).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", newTemplateError(field, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", newTemplateError(field, err)
+	}
+	return buf.String(), nil
+}
+
+// renderHTML renders an html/template, escaping data for its context.
+func renderHTML(field, text string, data interface{}) (string, error) {
+	tmpl, err := htmltemplate.New(field).Funcs(htmltemplate.FuncMap(templateFuncs)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", newTemplateError(field, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", newTemplateError(field, err)
+	}
+	return buf.String(), nil
+}
+
+// renderTemplates renders a subject, HTML and text template with data.
+// Empty templates render to empty strings.
+func renderTemplates(subject, html, text string, data interface{}) (*renderedContent, error) {
+	var out renderedContent
+	var err error
+	if out.Subject, err = renderText("subject", subject, data); err != nil {
+		return nil, err
+	}
+	if html != "" {
+		if out.HTML, err = renderHTML("htmlBody", html, data); err != nil {
+			return nil, err
+		}
+	}
+	if text != "" {
+		if out.Text, err = renderText("textBody", text, data); err != nil {
+			return nil, err
+		}
+	}
+	return &out, nil
+}
+
+// decodeTemplateData converts an Email's templateData into template values.
+func decodeTemplateData(data map[string]apiextensionsv1.JSON) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(data))
+	for key, raw := range data {
+		var v interface{}
+		if err := json.Unmarshal(raw.Raw, &v); err != nil {
+			return nil, fmt.Errorf("templateData.%s: %w", key, err)
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+// renderEmail returns a copy of email with its subject and bodies rendered.
+// With a templateRef they come from the EmailTemplate; otherwise the Email's
+// own fields are rendered when it has template data. Emails with neither
+// are returned unchanged.
+func (r *EmailReconciler) renderEmail(ctx context.Context, email *emailv1.Email) (*emailv1.Email, error) {
+	spec := email.Spec
+	if spec.TemplateRef == "" && len(spec.TemplateData) == 0 && len(spec.TemplateDataFrom) == 0 {
+		return email, nil
+	}
+	data, err := r.templateValues(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := email.DeepCopy()
+	if spec.TemplateRef != "" {
+		var tmpl emailv1.EmailTemplate
+		if err := r.Get(ctx, client.ObjectKey{Name: spec.TemplateRef, Namespace: email.Namespace}, &tmpl); err != nil {
+			return nil, fmt.Errorf("failed to get EmailTemplate %s: %w", spec.TemplateRef, err)
+		}
+		content, err := renderTemplates(tmpl.Spec.Subject, tmpl.Spec.HTMLBody, tmpl.Spec.TextBody, data)
+		if err != nil {
+			return nil, fmt.Errorf("EmailTemplate %s: %w", tmpl.Name, err)
+		}
+		rendered.Spec.Subject = content.Subject
+		rendered.Spec.HTMLBody = content.HTML
+		rendered.Spec.TextBody = content.Text
+		rendered.Spec.Body = ""
+		return rendered, nil
+	}
+
+	content, err := renderTemplates(spec.Subject, spec.HTMLBody, spec.TextBody, data)
+	if err != nil {
+		return nil, err
+	}
+	rendered.Spec.Subject = content.Subject
+	rendered.Spec.HTMLBody = content.HTML
+	rendered.Spec.TextBody = content.Text
+	if spec.Body != "" {
+		if rendered.Spec.Body, err = renderText("body", spec.Body, data); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// templateValues merges an Email's templateDataFrom sources, in order, and
+// then its inline templateData.
+func (r *EmailReconciler) templateValues(ctx context.Context, email *emailv1.Email) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for i, source := range email.Spec.TemplateDataFrom {
+		if err := r.addTemplateValues(ctx, email.Namespace, source, values); err != nil {
+			return nil, fmt.Errorf("spec.templateDataFrom[%d]: %w", i, err)
+		}
+	}
+	inline, err := decodeTemplateData(email.Spec.TemplateData)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range inline {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// addTemplateValues adds the values of a single templateDataFrom source.
+func (r *EmailReconciler) addTemplateValues(ctx context.Context, namespace string, source emailv1.TemplateDataSource, values map[string]interface{}) error {
+	sources := 0
+	for _, set := range []bool{source.ConfigMapRef != nil, source.SecretRef != nil, source.ObjectRef != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("exactly one of configMapRef, secretRef and objectRef must be set")
+	}
+
+	switch {
+	case source.ConfigMapRef != nil:
+		var cm corev1.ConfigMap
+		if err := r.Get(ctx, client.ObjectKey{Name: source.ConfigMapRef.Name, Namespace: namespace}, &cm); err != nil {
+			return fmt.Errorf("failed to get ConfigMap %s: %w", source.ConfigMapRef.Name, err)
+		}
+		for key, value := range cm.Data {
+			values[key] = value
+		}
+		for key, value := range cm.BinaryData {
+			values[key] = string(value)
+		}
+	case source.SecretRef != nil:
+		data, err := r.getSecretValues(ctx, namespace, source.SecretRef.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get Secret %s: %w", source.SecretRef.Name, err)
+		}
+		for key, value := range data {
+			values[key] = string(value)
+		}
+	default:
+		value, err := r.objectField(ctx, namespace, *source.ObjectRef)
+		if err != nil {
+			return err
+		}
+		values[source.ObjectRef.Key] = value
+	}
+	return nil
+}
+
+// objectField reads the field of an object selected by a JSONPath. A path
+// that matches several fields gives a list.
+func (r *EmailReconciler) objectField(ctx context.Context, namespace string, ref emailv1.TemplateObjectReference) (interface{}, error) {
+	if ref.Key == "" {
+		return nil, errors.New("objectRef.key is required")
+	}
+	var obj unstructured.Unstructured
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+	if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, &obj); err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %w", ref.Kind, ref.Name, err)
+	}
+
+	jp := jsonpath.New(ref.Key).AllowMissingKeys(false)
+	if err := jp.Parse(normalizeJSONPath(ref.JSONPath)); err != nil {
+		return nil, fmt.Errorf("invalid jsonPath %s: %w", ref.JSONPath, err)
+	}
+	results, err := jp.FindResults(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", ref.Kind, ref.Name, err)
+	}
+	var matches []interface{}
+	for _, result := range results {
+		for _, v := range result {
+			matches = append(matches, v.Interface())
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%s %s: jsonPath %s matched nothing", ref.Kind, ref.Name, ref.JSONPath)
+	case 1:
+		return matches[0], nil
+	default:
+		return matches, nil
+	}
+}
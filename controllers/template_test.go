@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	emailv1 "github.com/awesomeahi95/mailerlite/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Template rendering", func() {
+	data := map[string]interface{}{
+		"name":  "ada lovelace",
+		"items": []interface{}{"tea", "cake"},
+		"count": 2,
+	}
+
+	It("provides sprig-like helpers", func() {
+		out, err := renderText("subject", `{{ .name | title }} {{ join ", " .items | upper }} {{ .missing | default "none" }}`, map[string]interface{}{
+			"name": "ada lovelace", "items": []interface{}{"tea", "cake"}, "missing": "",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("Ada Lovelace TEA, CAKE none"))
+
+		out, err = renderText("textBody", `{{ add .count 1 }} {{ ternary "many" "few" (gt .count 1) }} {{ "hi" | b64enc }}`, data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal("3 many aGk="))
+	})
+
+	It("escapes data in HTML bodies", func() {
+		out, err := renderHTML("htmlBody", `<a href="/u?n={{ .name }}">{{ .name }}</a>`, map[string]interface{}{"name": "<b>&"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(`<a href="/u?n=%3cb%3e%26">&lt;b&gt;&amp;</a>`))
+	})
+
+	It("reports missing keys with their line and column", func() {
+		_, err := renderTemplates("Hi", "<p>\n  {{ .nmae }}</p>", "", data)
+		Expect(err).To(MatchError(`htmlBody: line 2, column 5: <.nmae>: map has no entry for key "nmae"`))
+		Expect(err).To(BeAssignableToTypeOf(&TemplateError{}))
+	})
+
+	It("reports parse errors with their line", func() {
+		_, err := renderTemplates("Hi", "", "a\n{{ if .name }}", data)
+		Expect(err).To(MatchError(ContainSubstring("textBody: line 2: ")))
+	})
+
+	It("decodes templateData values", func() {
+		decoded, err := decodeTemplateData(map[string]apiextensionsv1.JSON{
+			"name":  {Raw: []byte(`"Ada"`)},
+			"order": {Raw: []byte(`{"total": 12.5, "items": ["tea"]}`)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(map[string]interface{}{
+			"name":  "Ada",
+			"order": map[string]interface{}{"total": 12.5, "items": []interface{}{"tea"}},
+		}))
+	})
+})
+
+var _ = Describe("Template data sources", func() {
+	var (
+		ctx   context.Context
+		r     *EmailReconciler
+		email *emailv1.Email
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		r = &EmailReconciler{
+			Client: fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "release", Namespace: "default"},
+					Data:       map[string]string{"app": "shop", "env": "staging"},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "release-secrets", Namespace: "default"},
+					Data:       map[string][]byte{"env": []byte("production")},
+				},
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+					Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "shop", Image: "shop:1.4.2"}, {Name: "proxy", Image: "envoy:1.20"}},
+					}}},
+				},
+			).Build(),
+		}
+		email = &emailv1.Email{
+			ObjectMeta: metav1.ObjectMeta{Name: "email", Namespace: "default"},
+			Spec: emailv1.EmailSpec{
+				Subject: "{{ .app }} deployed to {{ .env }}",
+				Body:    "Image: {{ .image }}\nAll: {{ join \" \" .images }}",
+				TemplateDataFrom: []emailv1.TemplateDataSource{
+					{ConfigMapRef: &corev1.LocalObjectReference{Name: "release"}},
+					{SecretRef: &corev1.LocalObjectReference{Name: "release-secrets"}},
+					{ObjectRef: &emailv1.TemplateObjectReference{
+						APIVersion: "apps/v1", Kind: "Deployment", Name: "shop",
+						JSONPath: ".spec.template.spec.containers[0].image", Key: "image",
+					}},
+					{ObjectRef: &emailv1.TemplateObjectReference{
+						APIVersion: "apps/v1", Kind: "Deployment", Name: "shop",
+						JSONPath: "{.spec.template.spec.containers[*].image}", Key: "images",
+					}},
+				},
+			},
+		}
+	})
+
+	It("renders the Email's own fields with merged values", func() {
+		rendered, err := r.renderEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Spec.Subject).To(Equal("shop deployed to production"))
+		Expect(rendered.Spec.Body).To(Equal("Image: shop:1.4.2\nAll: shop:1.4.2 envoy:1.20"))
+		Expect(email.Spec.Subject).To(Equal("{{ .app }} deployed to {{ .env }}"))
+	})
+
+	It("lets inline templateData override the sources", func() {
+		email.Spec.TemplateData = map[string]apiextensionsv1.JSON{"env": {Raw: []byte(`"canary"`)}}
+		rendered, err := r.renderEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Spec.Subject).To(Equal("shop deployed to canary"))
+	})
+
+	It("leaves Emails without template data untouched", func() {
+		email.Spec.TemplateDataFrom = nil
+		rendered, err := r.renderEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(BeIdenticalTo(email))
+	})
+
+	It("reports missing keys instead of rendering them empty", func() {
+		email.Spec.Subject = "{{ .app }} {{ .version }}"
+		_, err := r.renderEmail(ctx, email)
+		Expect(err).To(MatchError(`subject: line 1, column 14: <.version>: map has no entry for key "version"`))
+	})
+
+	It("reports missing sources and fields", func() {
+		email.Spec.TemplateDataFrom[0].ConfigMapRef.Name = "nope"
+		_, err := r.renderEmail(ctx, email)
+		Expect(err).To(MatchError(ContainSubstring("spec.templateDataFrom[0]: failed to get ConfigMap nope")))
+
+		email.Spec.TemplateDataFrom[0].ConfigMapRef.Name = "release"
+		email.Spec.TemplateDataFrom[2].ObjectRef.JSONPath = ".spec.paused"
+		_, err = r.renderEmail(ctx, email)
+		Expect(err).To(MatchError(ContainSubstring("spec.templateDataFrom[2]: Deployment shop: paused is not found")))
+	})
+})
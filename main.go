@@ -3,6 +3,9 @@ package main
 import (
 	"flag"
 	"os"
+	// Embed the time zone database for Email spec.timeZone, since the
+	// alpine base image has none.
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -36,8 +39,19 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var captureAddr string
+	var captureBufferSize int
+	var attachmentDir string
+	var maxAttachmentSize int64
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&captureAddr, "capture-bind-address", "0", "The address the captured email inbox binds to. "+
+		"Setting this enables the Capture provider. Set to 0 to disable it.")
+	flag.IntVar(&captureBufferSize, "capture-buffer-size", 100, "The number of captured emails kept in memory.")
+	flag.StringVar(&attachmentDir, "attachment-dir", "", "The directory filePath attachments are read from, "+
+		"usually a mounted volume. File attachments are disabled when empty.")
+	flag.Int64Var(&maxAttachmentSize, "max-attachment-size", controllers.DefaultMaxAttachmentSize,
+		"The maximum total size in bytes of an email's attachments.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -71,14 +85,27 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers.EmailReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("email-controller"),
+
+		AttachmentDir:     attachmentDir,
+		MaxAttachmentSize: maxAttachmentSize,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Email")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
+	if captureAddr != "0" {
+		captures := controllers.NewCaptureStore(captureBufferSize)
+		controllers.DefaultProviders.Register(string(emailv1.ProviderCapture), captures.NewProvider)
+		if err := mgr.Add(&controllers.CaptureServer{Addr: captureAddr, Store: captures}); err != nil {
+			setupLog.Error(err, "unable to set up captured email inbox")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)